@@ -3,6 +3,7 @@ package spectrum
 import "sync"
 
 type cacheEntry struct {
+	owner      *conn
 	data       []byte
 	protocolID int32
 }
@@ -21,15 +22,25 @@ func GetCache(xuid string) ([]byte, int32) {
 	return nil, 0
 }
 
-func setCache(xuid string, data []byte, protocolID int32) {
+// setCache makes the cache of the connection passed available through GetCache. Connections without an XUID are
+// skipped, as their caches could not be told apart.
+func setCache(owner *conn) {
+	if owner.identityData.XUID == "" {
+		return
+	}
+
 	cacheMu.Lock()
-	cache[xuid] = cacheEntry{data: data, protocolID: protocolID}
+	cache[owner.identityData.XUID] = cacheEntry{owner: owner, data: owner.cache, protocolID: owner.protocolID}
 	cacheMu.Unlock()
 }
 
-func deleteCache(xuid string) {
+// deleteCache deletes the cache entry of the XUID of the connection passed, unless the entry has since been
+// taken over by another connection with the same XUID.
+func deleteCache(owner *conn) {
 	cacheMu.Lock()
-	delete(cache, xuid)
+	if c, ok := cache[owner.identityData.XUID]; ok && c.owner == owner {
+		delete(cache, owner.identityData.XUID)
+	}
 	cacheMu.Unlock()
 }
 
@@ -0,0 +1,38 @@
+package capture
+
+import "time"
+
+// Direction is the direction a captured frame travelled in.
+type Direction uint8
+
+const (
+	// DirectionIncoming is used for frames read from the proxy.
+	DirectionIncoming Direction = iota
+	// DirectionOutgoing is used for frames written to the proxy.
+	DirectionOutgoing
+)
+
+// String ...
+func (d Direction) String() string {
+	switch d {
+	case DirectionIncoming:
+		return "incoming"
+	case DirectionOutgoing:
+		return "outgoing"
+	default:
+		return "unknown"
+	}
+}
+
+// Frame is a single frame exchanged with the proxy.
+type Frame struct {
+	// Direction is the direction the frame travelled in.
+	Direction Direction
+	// Time is the time at which the frame was read or written.
+	Time time.Time
+	// Decode is the decode byte that preceded the frame, telling the proxy whether it had to decode the packet.
+	// It is only meaningful for outgoing frames.
+	Decode uint8
+	// Payload is the decompressed payload of the frame, holding the packet header followed by the packet.
+	Payload []byte
+}
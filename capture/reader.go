@@ -0,0 +1,62 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxPayloadSize is the maximum size of a frame payload accepted by Reader, protecting against corrupted
+// captures causing huge allocations.
+const maxPayloadSize = 64 * 1024 * 1024
+
+// Reader reads frames from a capture written by Writer.
+type Reader struct {
+	r io.Reader
+}
+
+// NewReader creates a Reader that reads a capture from the reader passed, validating its header.
+func NewReader(r io.Reader) (*Reader, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+
+	if [4]byte(header[:4]) != magic {
+		return nil, errors.New("read capture header: invalid magic")
+	}
+
+	if header[4] != version {
+		return nil, fmt.Errorf("read capture header: unsupported version %v", header[4])
+	}
+	return &Reader{r: r}, nil
+}
+
+// ReadFrame reads the next frame from the capture. It returns io.EOF once all frames have been read.
+func (r *Reader) ReadFrame() (Frame, error) {
+	var record [14]byte
+	if _, err := io.ReadFull(r.r, record[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Frame{}, fmt.Errorf("read frame: %w", err)
+		}
+		return Frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(record[10:14])
+	if length > maxPayloadSize {
+		return Frame{}, fmt.Errorf("read frame: payload size %v exceeds maximum of %v", length, maxPayloadSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return Frame{}, fmt.Errorf("read frame: %w", err)
+	}
+	return Frame{
+		Direction: Direction(record[0]),
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(record[1:9]))),
+		Decode:    record[9],
+		Payload:   payload,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+
+	tr "github.com/cooldogedev/spectrum-df/transport"
+	spectrumprotocol "github.com/cooldogedev/spectrum/protocol"
+	"github.com/golang/snappy"
+)
+
+// replayStream is a stream that plays back the incoming frames of a capture as if they were sent by the proxy.
+// Everything written to it is discarded.
+type replayStream struct {
+	r      *Reader
+	buf    bytes.Buffer
+	writer *spectrumprotocol.Writer
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewReplayStream creates a stream that plays back the incoming frames of the capture read from r, framed and
+// compressed the same way the proxy would send them. Writes to the stream are discarded. Once all frames have
+// been played back, reads return io.EOF.
+func NewReplayStream(r io.Reader) (io.ReadWriteCloser, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &replayStream{r: reader, closed: make(chan struct{})}
+	s.writer = spectrumprotocol.NewWriter(&s.buf)
+	return s, nil
+}
+
+// Read ...
+func (s *replayStream) Read(p []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, io.ErrClosedPipe
+	default:
+	}
+
+	for s.buf.Len() == 0 {
+		frame, err := s.r.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		if frame.Direction != DirectionIncoming {
+			continue
+		}
+
+		if err := s.writer.Write(snappy.Encode(nil, frame.Payload)); err != nil {
+			return 0, err
+		}
+	}
+	return s.buf.Read(p)
+}
+
+// Write ...
+func (s *replayStream) Write(p []byte) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, io.ErrClosedPipe
+	default:
+		return len(p), nil
+	}
+}
+
+// Close ...
+func (s *replayStream) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+// ReplayTransport is a transport that, instead of listening on the network, returns one replay stream per
+// capture passed to NewReplayTransport from Accept. It allows reproducing a recorded session on a Listener
+// without a proxy or a Minecraft client. As the authentication challenge differs for every stream, captures can
+// only be replayed on a Listener without a shared secret.
+type ReplayTransport struct {
+	captures []io.Reader
+	incoming chan io.ReadWriteCloser
+	closed   chan struct{}
+}
+
+// Compile time check to make sure ReplayTransport implements transport.Transport.
+var _ tr.Transport = (*ReplayTransport)(nil)
+
+// NewReplayTransport creates a ReplayTransport playing back the captures passed.
+func NewReplayTransport(captures ...io.Reader) *ReplayTransport {
+	return &ReplayTransport{
+		captures: captures,
+		incoming: make(chan io.ReadWriteCloser, len(captures)),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Listen ...
+func (t *ReplayTransport) Listen(string) error {
+	for _, capture := range t.captures {
+		stream, err := NewReplayStream(capture)
+		if err != nil {
+			return err
+		}
+		t.incoming <- stream
+	}
+	return nil
+}
+
+// Accept ...
+func (t *ReplayTransport) Accept() (io.ReadWriteCloser, tr.StreamInfo, error) {
+	select {
+	case <-t.closed:
+		return nil, tr.StreamInfo{}, errors.New("closed listener")
+	case c := <-t.incoming:
+		return c, tr.StreamInfo{Transport: "replay"}, nil
+	}
+}
+
+// SetFilter ...
+func (t *ReplayTransport) SetFilter(*tr.Filter) {}
+
+// SetLogger ...
+func (t *ReplayTransport) SetLogger(*slog.Logger) {}
+
+// Close ...
+func (t *ReplayTransport) Close() error {
+	select {
+	case <-t.closed:
+		return errors.New("already closed")
+	default:
+		close(t.closed)
+		return nil
+	}
+}
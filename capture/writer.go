@@ -0,0 +1,48 @@
+package capture
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// magic is written at the start of every capture, followed by the version of the format.
+var magic = [4]byte{'S', 'P', 'C', 'P'}
+
+// version is the version of the capture format written by Writer.
+const version = 1
+
+// Writer writes frames to a capture. A capture consists of a header holding the magic and the version of the
+// format, followed by one record per frame:
+//
+//	direction (uint8) | unix nano timestamp (int64) | decode byte (uint8) | payload length (uint32) | payload
+//
+// All integers are encoded in big endian. A Writer is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter creates a Writer that writes a capture to the writer passed, starting with its header.
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := append(magic[:], version)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteFrame writes a single frame to the capture.
+func (w *Writer) WriteFrame(frame Frame) error {
+	record := make([]byte, 14, 14+len(frame.Payload))
+	record[0] = byte(frame.Direction)
+	binary.BigEndian.PutUint64(record[1:9], uint64(frame.Time.UnixNano()))
+	record[9] = frame.Decode
+	binary.BigEndian.PutUint32(record[10:14], uint32(len(frame.Payload)))
+	record = append(record, frame.Payload...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.w.Write(record)
+	return err
+}
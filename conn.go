@@ -3,18 +3,25 @@ package spectrum
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"log/slog"
 	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	spectrumprotocol "github.com/cooldogedev/spectrum/protocol"
+	"github.com/cooldogedev/spectrum-df/capture"
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	tr "github.com/cooldogedev/spectrum-df/transport"
 	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/df-mc/dragonfly/server/session"
 	"github.com/golang/snappy"
 	"github.com/google/uuid"
 	"github.com/sandertv/gophertunnel/minecraft"
@@ -28,48 +35,123 @@ const (
 	packetDecodeNotNeeded
 )
 
+var (
+	errUnknownPacket   = errors.New("unknown packet ID")
+	errMalformedPacket = errors.New("malformed packet")
+	errConnClosed      = fmt.Errorf("spectrum connection: %w", net.ErrClosed)
+	errWriteQueueFull  = errors.New("write queue full: proxy is not reading")
+	errStatusOnly      = errors.New("stream closed after status request")
+	errStatusUpdates   = errors.New("stream subscribed to status updates")
+)
+
 var bufferPool = sync.Pool{
 	New: func() any {
 		return bytes.NewBuffer(make([]byte, 0, 256))
 	},
 }
 
+// maxPooledFrameSize is the maximum capacity of a frame buffer returned to framePool. Larger buffers, such as
+// those used for chunk heavy frames, are left to the garbage collector so that the pool does not pin them.
+const maxPooledFrameSize = 1024 * 1024
+
+var framePool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
 var headerPool = sync.Pool{
 	New: func() any {
 		return &packet.Header{}
 	},
 }
 
+// Conn is the connection of a player that joined through the proxy. Every session.Conn returned by a Listener
+// implements Conn, and the Conn of a player may be obtained using PlayerConn.
+type Conn interface {
+	session.Conn
+	// ProxyAddr returns the address of the proxy that the player is connected through. It may be nil if the
+	// transport does not expose it.
+	ProxyAddr() net.Addr
+	// StreamInfo returns the information about the connection of the proxy that the player is connected through.
+	StreamInfo() tr.StreamInfo
+	// Cache returns the cache sent by the proxy in the ConnectionRequest of the player.
+	Cache() []byte
+	// ProtocolID returns the protocol ID of the player, as sent by the proxy in the ConnectionRequest.
+	ProtocolID() int32
+	// RuntimeID returns the runtime ID of the player sent to the proxy in the ConnectionResponse.
+	RuntimeID() uint64
+}
+
+// Compile time check to make sure conn implements Conn.
+var _ Conn = (*conn)(nil)
+
 type conn struct {
-	addr         *net.UDPAddr
-	conn         io.ReadWriteCloser
-	reader       *spectrumprotocol.Reader
-	writer       *spectrumprotocol.Writer
-	clientData   login.ClientData
-	identityData login.IdentityData
-	runtimeID    uint64
-	uniqueID     int64
-	shieldID     int32
-	latency      atomic.Value
-	pool         packet.Pool
-	closed       chan struct{}
-}
-
-func newConn(rwc io.ReadWriteCloser, pool packet.Pool) (*conn, error) {
+	addr              *net.UDPAddr
+	info              tr.StreamInfo
+	conn              io.ReadWriteCloser
+	clientData        login.ClientData
+	identityData      login.IdentityData
+	runtimeID         uint64
+	uniqueID          int64
+	shieldID          atomic.Int32
+	cache             []byte
+	protocolID        int32
+	latency           atomic.Value
+	pool              packet.Pool
+	listener          *Listener
+	log               *slog.Logger
+	established       atomic.Bool
+	disconnecting     atomic.Bool
+	disconnectReasons bool
+	shutdown          atomic.Bool
+	closing           atomic.Bool
+	recorder          *recorder
+	decodeFailures    atomic.Int32
+	closeReason       atomic.Pointer[error]
+	streams           []*stream
+	datagrams         tr.DatagramSender
+	datagramID        uint32
+	statusSent        bool
+	routes            [priorityCount]*stream
+	writing           bool
+	closed            chan struct{}
+}
+
+func newConn(rwc io.ReadWriteCloser, info tr.StreamInfo, l *Listener) (*conn, error) {
 	c := &conn{
-		conn:   rwc,
-		reader: spectrumprotocol.NewReader(rwc),
-		writer: spectrumprotocol.NewWriter(rwc),
-		pool:   pool,
-		closed: make(chan struct{}),
+		info:     info,
+		conn:     rwc,
+		pool:     l.pool,
+		listener: l,
+		log:      l.log,
+		closed:   make(chan struct{}),
+	}
+	main := newStream(c, rwc)
+	for priority := range priorityCount {
+		main.route(priority)
+	}
+	c.streams = append(c.streams, main)
+	if l.capture != nil {
+		c.recorder = &recorder{}
+	}
+	if len(l.secret) > 0 {
+		if err := c.authenticate(l.secret); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
 	}
-	connectionRequestPacket, err := c.expect(spectrumpacket.IDConnectionRequest)
-	if err != nil {
+
+	connectionRequest, requested, err := c.readConnectionRequest()
+	if errors.Is(err, errStatusUpdates) {
+		// The stream is handed over to the Listener as is, which keeps it open to send it status updates.
+		return c, err
+	} else if err != nil {
 		_ = c.Close()
 		return nil, err
 	}
 
-	connectionRequest, _ := connectionRequestPacket.(*spectrumpacket.ConnectionRequest)
 	addr, err := net.ResolveUDPAddr("udp", connectionRequest.Addr)
 	if err != nil {
 		_ = c.Close()
@@ -87,28 +169,131 @@ func newConn(rwc io.ReadWriteCloser, pool packet.Pool) (*conn, error) {
 		return nil, err
 	}
 
+	if err := c.verifyLogin(requested.loginRequest); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	c.disconnectReasons = requested.disconnectReasons
+	c.log = l.log.With("xuid", c.identityData.XUID, "addr", c.addr.String(), "proxy", info.RemoteAddr)
 	c.runtimeID = uint64(crc32.ChecksumIEEE([]byte(c.identityData.XUID)))
+	if c.identityData.XUID == "" {
+		// Players joining through a proxy in offline mode have no XUID, so the identity is used to keep their
+		// runtime IDs apart.
+		c.runtimeID = uint64(crc32.ChecksumIEEE([]byte(c.identityData.Identity)))
+	}
 	c.uniqueID = int64(c.runtimeID)
+	if requested.streams {
+		if err := c.openStreams(); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if requested.datagrams {
+		if err := c.enableDatagrams(); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if requested.resourcePacks {
+		if err := c.sendResourcePacks(); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
 	if err := c.WritePacket(&spectrumpacket.ConnectionResponse{RuntimeID: c.runtimeID, UniqueID: c.uniqueID}); err != nil {
 		_ = c.Close()
 		return nil, err
 	}
-	setCache(c.identityData.XUID, connectionRequest.Cache, connectionRequest.ProtocolID)
+	c.cache = connectionRequest.Cache
+	c.protocolID = connectionRequest.ProtocolID
 	c.latency.Store(time.Duration(0))
+	c.startWriting()
 	return c, nil
 }
 
+// features holds the optional features requested by the proxy ahead of its ConnectionRequest.
+type features struct {
+	streams           bool
+	datagrams         bool
+	resourcePacks     bool
+	disconnectReasons bool
+	loginRequest      []byte
+}
+
+// readConnectionRequest reads packets until the ConnectionRequest of the proxy is read. It also returns the
+// optional features requested by the proxy ahead of it. If the proxy requests status updates instead,
+// errStatusUpdates is returned.
+func (c *conn) readConnectionRequest() (*spectrumpacket.ConnectionRequest, features, error) {
+	var requested features
+	for {
+		pk, err := c.read()
+		if err != nil && c.statusSent {
+			// Proxies may open a stream only to request the status of the server, closing it once the Status is
+			// read. How the close is reported depends on the transport, so any error reading from the stream ends
+			// it quietly once the Status was sent.
+			return nil, features{}, fmt.Errorf("%w: %w", errStatusOnly, err)
+		} else if err != nil {
+			return nil, features{}, err
+		}
+
+		switch pk := pk.(type) {
+		case *dfpacket.StreamRequest:
+			requested.streams = true
+		case *dfpacket.DatagramRequest:
+			requested.datagrams = true
+		case *dfpacket.ResourcePacksRequest:
+			requested.resourcePacks = true
+		case *dfpacket.DisconnectReasonRequest:
+			requested.disconnectReasons = true
+		case *dfpacket.LoginRequest:
+			requested.loginRequest = pk.Request
+		case *dfpacket.StatusRequest:
+			if err := c.handleStatusRequest(pk); err != nil {
+				return nil, features{}, err
+			}
+			if pk.Updates && c.listener.statusInterval > 0 {
+				return nil, features{}, errStatusUpdates
+			}
+		case *spectrumpacket.ConnectionRequest:
+			return pk, requested, nil
+		}
+	}
+}
+
 // ReadPacket ...
 func (c *conn) ReadPacket() (packet.Packet, error) {
 	pk, err := c.read()
 	if err != nil {
+		c.setCloseReason(err)
 		return nil, err
 	}
 
 	if pk, ok := pk.(*spectrumpacket.Latency); ok {
 		latency := (time.Now().UnixMilli() - pk.Timestamp) + pk.Latency
 		c.latency.Store(time.Duration(latency) * time.Millisecond)
-		_ = c.WritePacket(&spectrumpacket.Latency{Timestamp: 0, Latency: latency})
+		c.listener.metrics.Latency(time.Duration(latency) * time.Millisecond)
+		c.listener.handler.HandleLatency(c, time.Duration(latency)*time.Millisecond)
+		if err := c.WritePacket(&spectrumpacket.Latency{Timestamp: 0, Latency: latency}); err != nil {
+			c.log.Debug("failed to reply to latency packet", "err", err)
+		}
+		return c.ReadPacket()
+	}
+
+	if pk, ok := pk.(*packet.ResourcePackChunkRequest); ok {
+		if err := c.handleResourcePackChunkRequest(pk); err != nil {
+			c.log.Debug("failed to send resource pack chunk", "err", err)
+		}
+		return c.ReadPacket()
+	}
+
+	if pk, ok := pk.(*dfpacket.StatusRequest); ok {
+		if err := c.handleStatusRequest(pk); err != nil {
+			c.log.Debug("failed to reply to status request", "err", err)
+		}
 		return c.ReadPacket()
 	}
 	return pk, nil
@@ -116,6 +301,29 @@ func (c *conn) ReadPacket() (packet.Packet, error) {
 
 // WritePacket ...
 func (c *conn) WritePacket(pk packet.Packet) error {
+	select {
+	case <-c.closed:
+		return errConnClosed
+	default:
+	}
+
+	if pk, ok := pk.(*packet.Disconnect); ok {
+		c.disconnectReason(DisconnectReasonUnspecified, pk.Message)
+	}
+
+	frame, err := c.encode(pk)
+	if err != nil {
+		return err
+	}
+
+	if c.sendDatagram(pk, frame) {
+		return nil
+	}
+	return c.enqueue(frame, c.listener.priority(pk.ID()))
+}
+
+// encode translates and encodes a packet into a frame ready to be written to the proxy.
+func (c *conn) encode(pk packet.Packet) (*[]byte, error) {
 	buf := bufferPool.Get().(*bytes.Buffer)
 	header := headerPool.Get().(*packet.Header)
 	defer func() {
@@ -127,7 +335,7 @@ func (c *conn) WritePacket(pk packet.Packet) error {
 	pk = c.translatePacket(pk, true)
 	header.PacketID = pk.ID()
 	if err := header.Write(buf); err != nil {
-		return err
+		return nil, err
 	}
 
 	var decodeByte byte
@@ -136,8 +344,13 @@ func (c *conn) WritePacket(pk packet.Packet) error {
 	} else {
 		decodeByte = packetDecodeNotNeeded
 	}
-	pk.Marshal(protocol.NewWriter(buf, c.shieldID))
-	return c.writer.Write(append([]byte{decodeByte}, snappy.Encode(nil, buf.Bytes())...))
+	pk.Marshal(protocol.NewWriter(buf, c.shieldID.Load()))
+	frame := getFrame(1 + snappy.MaxEncodedLen(buf.Len()))
+	(*frame)[0] = decodeByte
+	*frame = (*frame)[:1+len(snappy.Encode((*frame)[1:], buf.Bytes()))]
+	c.listener.metrics.PacketWritten(pk.ID(), len(*frame), buf.Len(), decodeByte == packetDecodeNeeded)
+	c.recorder.record(capture.DirectionOutgoing, decodeByte, buf.Bytes())
+	return frame, nil
 }
 
 // Flush ...
@@ -165,21 +378,50 @@ func (c *conn) ClientCacheEnabled() bool {
 	return false
 }
 
-// RemoteAddr ...
+// RemoteAddr returns the address of the player, as reported by the proxy.
 func (c *conn) RemoteAddr() net.Addr {
 	return c.addr
 }
 
+// ProxyAddr ...
+func (c *conn) ProxyAddr() net.Addr {
+	return c.info.RemoteAddr
+}
+
+// StreamInfo ...
+func (c *conn) StreamInfo() tr.StreamInfo {
+	return c.info
+}
+
+// Cache ...
+func (c *conn) Cache() []byte {
+	return c.cache
+}
+
+// ProtocolID ...
+func (c *conn) ProtocolID() int32 {
+	return c.protocolID
+}
+
+// RuntimeID ...
+func (c *conn) RuntimeID() uint64 {
+	return c.runtimeID
+}
+
 // Latency ...
 func (c *conn) Latency() time.Duration {
 	return c.latency.Load().(time.Duration)
 }
 
+// StartGameFunc modifies the StartGame packet of a connection before it is written. The packet passed is built
+// from the minecraft.GameData passed, which is the data the server started the game of the connection with.
+type StartGameFunc func(conn session.Conn, pk *packet.StartGame, data minecraft.GameData)
+
 // StartGameContext ...
 func (c *conn) StartGameContext(_ context.Context, data minecraft.GameData) (err error) {
 	for _, item := range data.Items {
 		if item.Name == "minecraft:shield" {
-			c.shieldID = int32(item.RuntimeID)
+			c.shieldID.Store(int32(item.RuntimeID))
 			break
 		}
 	}
@@ -223,6 +465,10 @@ func (c *conn) StartGameContext(_ context.Context, data minecraft.GameData) (err
 		GameVersion:                  protocol.CurrentVersion,
 		UseBlockNetworkIDHashes:      data.UseBlockNetworkIDHashes,
 	}
+	if c.listener.startGame != nil {
+		c.listener.startGame(c, startGame, data)
+	}
+
 	if err = c.WritePacket(startGame); err != nil {
 		return err
 	}
@@ -251,35 +497,93 @@ func (c *conn) StartGameContext(_ context.Context, data minecraft.GameData) (err
 
 // Close ...
 func (c *conn) Close() (err error) {
-	select {
-	case <-c.closed:
+	// Close may be called from several goroutines at once, such as a writer timing out while the Listener shuts
+	// down, so only the first call may tear the connection down.
+	if !c.closing.CompareAndSwap(false, true) {
 		return errors.New("connection already closed")
-	default:
-		close(c.closed)
-		_ = c.conn.Close()
-		deleteCache(c.identityData.XUID)
-		return
+	}
+
+	close(c.closed)
+	c.awaitWriters()
+	for _, s := range c.streams {
+		if err := s.rwc.Close(); err != nil {
+			c.log.Debug("failed to close stream", "err", err)
+		}
+	}
+	deleteCache(c)
+	c.recorder.stop()
+	if c.listener.registry.remove(c) {
+		c.listener.metrics.ConnClosed()
+	}
+
+	if c.established.Load() {
+		var reason error
+		if r := c.closeReason.Load(); r != nil {
+			reason = *r
+		}
+		c.listener.handler.HandleClose(c, reason)
+	}
+	return
+}
+
+// setCloseReason sets the reason passed to ListenerHandler.HandleClose once the connection is closed. Only the
+// first reason set is kept, as it is the one that led to the connection being closed.
+func (c *conn) setCloseReason(reason error) {
+	c.closeReason.CompareAndSwap(nil, &reason)
+}
+
+// read reads a packet from the proxy and returns it. Packets with an unknown ID and packets that fail to
+// decode are skipped if the Listener is configured to tolerate them.
+func (c *conn) read() (packet.Packet, error) {
+	for {
+		pk, err := c.readPacket()
+		switch {
+		case err == nil:
+			return pk, nil
+		case errors.Is(err, errUnknownPacket) && c.listener.skipUnknownPackets:
+			c.log.Debug("skipping packet", "err", err)
+		case errors.Is(err, errMalformedPacket) && int(c.decodeFailures.Add(1)) <= c.listener.maxDecodeFailures:
+			c.log.Warn("skipping malformed packet", "err", err, "failures", c.decodeFailures.Load())
+		default:
+			return nil, err
+		}
 	}
 }
 
-// read reads a packet from the reader and returns it.
-func (c *conn) read() (pk packet.Packet, err error) {
+// readPacket reads a single frame from the proxy and decodes the packet it holds.
+func (c *conn) readPacket() (pk packet.Packet, err error) {
 	select {
 	case <-c.closed:
-		return nil, errors.New("connection closed")
+		return nil, errConnClosed
 	default:
 	}
 
-	payload, err := c.reader.ReadPacket()
+	compressed, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	defer putFrame(compressed)
+
+	payload := *compressed
+	decodedLen, err := snappy.DecodedLen(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	decompressed, err := snappy.Decode(nil, payload)
+	if decodedLen > c.listener.maxDecompressedSize {
+		return nil, fmt.Errorf("decompressed frame size %v exceeds maximum of %v", decodedLen, c.listener.maxDecompressedSize)
+	}
+
+	// The packet decoded below copies everything it reads from the frame, so the buffer can safely be reused
+	// once it is returned.
+	frame := getFrame(decodedLen)
+	defer putFrame(frame)
+	decompressed, err := snappy.Decode(*frame, payload)
 	if err != nil {
 		return nil, err
 	}
 
+	c.recorder.record(capture.DirectionIncoming, 0, decompressed)
 	buf := bytes.NewBuffer(decompressed)
 	header := headerPool.Get().(*packet.Header)
 	defer func() {
@@ -288,22 +592,109 @@ func (c *conn) read() (pk packet.Packet, err error) {
 	if err := header.Read(buf); err != nil {
 		return nil, err
 	}
+	c.listener.metrics.PacketRead(header.PacketID, len(payload), len(decompressed))
 
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("panic while decoding packet %v: %v", header.PacketID, r)
+			c.log.Error("panic while decoding packet", "id", header.PacketID, "panic", r)
+			err = fmt.Errorf("%w: panic while decoding packet %v: %v", errMalformedPacket, header.PacketID, r)
 		}
 	}()
 	factory, ok := c.pool[header.PacketID]
 	if !ok {
-		return nil, fmt.Errorf("unknown packet ID %v", header.PacketID)
+		return nil, fmt.Errorf("%w %v", errUnknownPacket, header.PacketID)
 	}
 	pk = factory()
-	pk.Marshal(protocol.NewReader(buf, c.shieldID, false))
+	// Limits are enabled like gophertunnel does for packets sent by clients, which caps the number of elements
+	// of the slices read from the packet. The length of byte slices and strings is not capped by the reader, so
+	// decoding may still allocate up to math.MaxInt32 bytes for a single field: only the compressed and
+	// decompressed sizes of the frame itself are bounded by the Listener.
+	pk.Marshal(protocol.NewReader(buf, c.shieldID.Load(), true))
+	if buf.Len() != 0 {
+		// Like gophertunnel, packets with trailing bytes are still handled, as these are usually the result of
+		// fields added in a newer protocol version.
+		c.log.Debug("unread bytes left in packet", "id", header.PacketID, "len", buf.Len())
+	}
 	pk = c.translatePacket(pk, false)
 	return
 }
 
+// readFrame reads the next frame sent by the proxy into a buffer obtained using getFrame. Frames are prefixed
+// with their length, which is checked against the maximum compressed size before the buffer for the frame is
+// allocated. This only caps the size of the frame, not the memory allocated when decoding the packet it holds.
+func (c *conn) readFrame() (*[]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(c.conn, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(prefix[:])
+	if uint64(length) > uint64(c.listener.maxCompressedSize) {
+		return nil, fmt.Errorf("compressed frame size %v exceeds maximum of %v", length, c.listener.maxCompressedSize)
+	}
+
+	frame := getFrame(int(length))
+	if _, err := io.ReadFull(c.conn, *frame); err != nil {
+		putFrame(frame)
+		return nil, err
+	}
+	return frame, nil
+}
+
+// getFrame returns a buffer of length n from framePool.
+func getFrame(n int) *[]byte {
+	frame := framePool.Get().(*[]byte)
+	if cap(*frame) < n {
+		*frame = make([]byte, n)
+	}
+	*frame = (*frame)[:n]
+	return frame
+}
+
+// putFrame returns a buffer obtained using getFrame to framePool, unless it grew too large to be kept around.
+func putFrame(frame *[]byte) {
+	if cap(*frame) > maxPooledFrameSize {
+		return
+	}
+	*frame = (*frame)[:0]
+	framePool.Put(frame)
+}
+
+// authenticate challenges the proxy to prove that it knows the shared secret passed. Both the request for the
+// challenge and the response must be the very first packets on the stream, so that an unauthenticated proxy
+// cannot get anything else processed first.
+func (c *conn) authenticate(secret []byte) error {
+	pk, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := pk.(*dfpacket.AuthRequest); !ok {
+		return fmt.Errorf("expected authentication request, got packet %v", pk.ID())
+	}
+
+	nonce := make([]byte, 32)
+	_, _ = rand.Read(nonce)
+	if err := c.WritePacket(&dfpacket.AuthChallenge{Nonce: nonce}); err != nil {
+		return err
+	}
+
+	pk, err = c.read()
+	if err != nil {
+		return err
+	}
+
+	response, ok := pk.(*dfpacket.AuthResponse)
+	if !ok {
+		return fmt.Errorf("expected authentication response, got packet %v", pk.ID())
+	}
+
+	if !hmac.Equal(response.MAC, dfpacket.Sign(secret, nonce)) {
+		return errors.New("authentication failed: invalid MAC")
+	}
+	return nil
+}
+
 // expect reads a packet from the connection and expects it to have the ID passed.
 func (c *conn) expect(id uint32) (packet.Packet, error) {
 	pk, err := c.ReadPacket()
@@ -550,18 +941,18 @@ func (c *conn) translateUniqueID(runtimeId int64, serverSent bool) int64 {
 func (c *conn) translateMetadata(metadata map[uint32]any, serverSent bool) map[uint32]any {
 	for key, value := range metadata {
 		switch key {
-		case protocol.EntityDataKeyOwner:
-			metadata[protocol.EntityDataKeyOwner] = c.translateUniqueID(value.(int64), serverSent)
-		case protocol.EntityDataKeyTarget:
-			metadata[key] = c.translateUniqueID(value.(int64), serverSent)
-		case protocol.EntityDataKeyDisplayOffset:
-			metadata[key] = c.translateUniqueID(value.(int64), serverSent)
-		case protocol.EntityDataKeyLeashHolder:
-			metadata[key] = c.translateUniqueID(value.(int64), serverSent)
-		case protocol.EntityDataKeyAgent:
-			metadata[key] = c.translateUniqueID(value.(int64), serverSent)
+		case protocol.EntityDataKeyOwner, protocol.EntityDataKeyTarget, protocol.EntityDataKeyDisplayOffset, protocol.EntityDataKeyLeashHolder, protocol.EntityDataKeyAgent:
+			if id, ok := value.(int64); ok {
+				metadata[key] = c.translateUniqueID(id, serverSent)
+			} else {
+				c.log.Debug("unexpected entity metadata type, leaving it untranslated", "key", key, "type", fmt.Sprintf("%T", value))
+			}
 		case protocol.EntityDataKeyBaseRuntimeID:
-			metadata[key] = c.translateRuntimeID(value.(uint64), serverSent)
+			if id, ok := value.(uint64); ok {
+				metadata[key] = c.translateRuntimeID(id, serverSent)
+			} else {
+				c.log.Debug("unexpected entity metadata type, leaving it untranslated", "key", key, "type", fmt.Sprintf("%T", value))
+			}
 		default:
 		}
 	}
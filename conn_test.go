@@ -0,0 +1,483 @@
+package spectrum
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cooldogedev/spectrum-df/metrics"
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	spectrumprotocol "github.com/cooldogedev/spectrum/protocol"
+	"github.com/df-mc/dragonfly/server/session"
+	"github.com/golang/snappy"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+const (
+	// testRuntimeID and testUniqueID are the IDs of the player as seen by the proxy. Like the IDs assigned by
+	// newConn, the unique ID holds the same value as the runtime ID.
+	testRuntimeID = uint64(0x5eed)
+	testUniqueID  = int64(testRuntimeID)
+	// otherID is the ID of an entity other than the player, which must never be translated.
+	otherID = 42
+)
+
+// translateCases holds a function for every packet handled by translatePacket, which returns the packet with all
+// of its entity ID fields set to the runtime and unique IDs passed.
+var translateCases = map[string]func(r uint64, u int64) packet.Packet{
+	"ActorEvent": func(r uint64, u int64) packet.Packet {
+		return &packet.ActorEvent{EntityRuntimeID: r}
+	},
+	"ActorPickRequest": func(r uint64, u int64) packet.Packet {
+		return &packet.ActorPickRequest{EntityUniqueID: u}
+	},
+	"AddActor": func(r uint64, u int64) packet.Packet {
+		return &packet.AddActor{
+			EntityUniqueID:  u,
+			EntityRuntimeID: r,
+			EntityMetadata:  testMetadata(r, u),
+			EntityLinks:     []protocol.EntityLink{{RiderEntityUniqueID: u, RiddenEntityUniqueID: u}},
+		}
+	},
+	"AddItemActor": func(r uint64, u int64) packet.Packet {
+		return &packet.AddItemActor{EntityUniqueID: u, EntityRuntimeID: r, EntityMetadata: testMetadata(r, u)}
+	},
+	"AddPainting": func(r uint64, u int64) packet.Packet {
+		return &packet.AddPainting{EntityUniqueID: u, EntityRuntimeID: r}
+	},
+	"AddPlayer": func(r uint64, u int64) packet.Packet {
+		return &packet.AddPlayer{
+			AbilityData:     protocol.AbilityData{EntityUniqueID: u},
+			EntityRuntimeID: r,
+			EntityMetadata:  testMetadata(r, u),
+			EntityLinks:     []protocol.EntityLink{{RiderEntityUniqueID: u, RiddenEntityUniqueID: u}},
+		}
+	},
+	"AddVolumeEntity": func(r uint64, u int64) packet.Packet {
+		return &packet.AddVolumeEntity{EntityRuntimeID: uint32(r)}
+	},
+	"AdventureSettings": func(r uint64, u int64) packet.Packet {
+		return &packet.AdventureSettings{PlayerUniqueID: u}
+	},
+	"AgentAnimation": func(r uint64, u int64) packet.Packet {
+		return &packet.AgentAnimation{EntityRuntimeID: r}
+	},
+	"Animate": func(r uint64, u int64) packet.Packet {
+		return &packet.Animate{EntityRuntimeID: r}
+	},
+	"AnimateEntity": func(r uint64, u int64) packet.Packet {
+		return &packet.AnimateEntity{EntityRuntimeIDs: []uint64{r, r}}
+	},
+	"BossEvent": func(r uint64, u int64) packet.Packet {
+		return &packet.BossEvent{BossEntityUniqueID: u, PlayerUniqueID: u}
+	},
+	"Camera": func(r uint64, u int64) packet.Packet {
+		return &packet.Camera{CameraEntityUniqueID: u, TargetPlayerUniqueID: u}
+	},
+	"ChangeMobProperty": func(r uint64, u int64) packet.Packet {
+		return &packet.ChangeMobProperty{EntityUniqueID: u}
+	},
+	"ClientBoundMapItemData": func(r uint64, u int64) packet.Packet {
+		return &packet.ClientBoundMapItemData{TrackedObjects: []protocol.MapTrackedObject{
+			{Type: protocol.MapObjectTypeEntity, EntityUniqueID: u},
+			// Block objects never hold an entity, so the ID is left alone regardless of its value.
+			{Type: protocol.MapObjectTypeBlock, EntityUniqueID: 1},
+		}}
+	},
+	"CommandBlockUpdate": func(r uint64, u int64) packet.Packet {
+		return &packet.CommandBlockUpdate{MinecartEntityRuntimeID: r}
+	},
+	"CommandOutput": func(r uint64, u int64) packet.Packet {
+		return &packet.CommandOutput{CommandOrigin: protocol.CommandOrigin{PlayerUniqueID: u}}
+	},
+	"CommandRequest": func(r uint64, u int64) packet.Packet {
+		return &packet.CommandRequest{CommandOrigin: protocol.CommandOrigin{PlayerUniqueID: u}}
+	},
+	"ContainerOpen": func(r uint64, u int64) packet.Packet {
+		return &packet.ContainerOpen{ContainerEntityUniqueID: u}
+	},
+	"CreatePhoto": func(r uint64, u int64) packet.Packet {
+		return &packet.CreatePhoto{EntityUniqueID: u}
+	},
+	"DebugInfo": func(r uint64, u int64) packet.Packet {
+		return &packet.DebugInfo{PlayerUniqueID: u}
+	},
+	"Emote": func(r uint64, u int64) packet.Packet {
+		return &packet.Emote{EntityRuntimeID: r}
+	},
+	"EmoteList": func(r uint64, u int64) packet.Packet {
+		return &packet.EmoteList{PlayerRuntimeID: r}
+	},
+	"Event": func(r uint64, u int64) packet.Packet {
+		return &packet.Event{
+			EntityRuntimeID: int64(r),
+			Event:           &protocol.MobKilledEvent{KillerEntityUniqueID: u, VictimEntityUniqueID: u},
+		}
+	},
+	"Interact": func(r uint64, u int64) packet.Packet {
+		return &packet.Interact{TargetEntityRuntimeID: r}
+	},
+	"InventoryTransaction": func(r uint64, u int64) packet.Packet {
+		return &packet.InventoryTransaction{
+			TransactionData: &protocol.UseItemOnEntityTransactionData{TargetEntityRuntimeID: r},
+		}
+	},
+	"MobArmourEquipment": func(r uint64, u int64) packet.Packet {
+		return &packet.MobArmourEquipment{EntityRuntimeID: r}
+	},
+	"MobEffect": func(r uint64, u int64) packet.Packet {
+		return &packet.MobEffect{EntityRuntimeID: r}
+	},
+	"MobEquipment": func(r uint64, u int64) packet.Packet {
+		return &packet.MobEquipment{EntityRuntimeID: r}
+	},
+	"MotionPredictionHints": func(r uint64, u int64) packet.Packet {
+		return &packet.MotionPredictionHints{EntityRuntimeID: r}
+	},
+	"MoveActorAbsolute": func(r uint64, u int64) packet.Packet {
+		return &packet.MoveActorAbsolute{EntityRuntimeID: r}
+	},
+	"MoveActorDelta": func(r uint64, u int64) packet.Packet {
+		return &packet.MoveActorDelta{EntityRuntimeID: r}
+	},
+	"MovePlayer": func(r uint64, u int64) packet.Packet {
+		return &packet.MovePlayer{EntityRuntimeID: r, RiddenEntityRuntimeID: r}
+	},
+	"NPCDialogue": func(r uint64, u int64) packet.Packet {
+		return &packet.NPCDialogue{EntityUniqueID: uint64(u)}
+	},
+	"NPCRequest": func(r uint64, u int64) packet.Packet {
+		return &packet.NPCRequest{EntityRuntimeID: r}
+	},
+	"PhotoTransfer": func(r uint64, u int64) packet.Packet {
+		return &packet.PhotoTransfer{OwnerEntityUniqueID: u}
+	},
+	"PlayerAction": func(r uint64, u int64) packet.Packet {
+		return &packet.PlayerAction{EntityRuntimeID: r}
+	},
+	"PlayerAuthInput": func(r uint64, u int64) packet.Packet {
+		inputData := protocol.NewBitset(packet.PlayerAuthInputBitsetSize)
+		inputData.Set(packet.InputFlagClientPredictedVehicle)
+		return &packet.PlayerAuthInput{InputData: inputData, ClientPredictedVehicle: u}
+	},
+	"PlayerList": func(r uint64, u int64) packet.Packet {
+		return &packet.PlayerList{Entries: []protocol.PlayerListEntry{{EntityUniqueID: u}, {EntityUniqueID: u}}}
+	},
+	"PrimitiveShapes": func(r uint64, u int64) packet.Packet {
+		return &packet.PrimitiveShapes{Shapes: []protocol.PrimitiveShape{
+			{AttachedToEntityID: protocol.Option(int64(r))},
+			{},
+		}}
+	},
+	"RemoveActor": func(r uint64, u int64) packet.Packet {
+		return &packet.RemoveActor{EntityUniqueID: u}
+	},
+	"RemoveVolumeEntity": func(r uint64, u int64) packet.Packet {
+		return &packet.RemoveVolumeEntity{EntityRuntimeID: uint32(r)}
+	},
+	"Respawn": func(r uint64, u int64) packet.Packet {
+		return &packet.Respawn{EntityRuntimeID: r}
+	},
+	"SetActorData": func(r uint64, u int64) packet.Packet {
+		return &packet.SetActorData{EntityRuntimeID: r, EntityMetadata: testMetadata(r, u)}
+	},
+	"SetActorLink": func(r uint64, u int64) packet.Packet {
+		return &packet.SetActorLink{EntityLink: protocol.EntityLink{RiderEntityUniqueID: u, RiddenEntityUniqueID: u}}
+	},
+	"SetActorMotion": func(r uint64, u int64) packet.Packet {
+		return &packet.SetActorMotion{EntityRuntimeID: r}
+	},
+	"SetLocalPlayerAsInitialised": func(r uint64, u int64) packet.Packet {
+		return &packet.SetLocalPlayerAsInitialised{EntityRuntimeID: r}
+	},
+	"SetScore": func(r uint64, u int64) packet.Packet {
+		return &packet.SetScore{Entries: []protocol.ScoreboardEntry{
+			{IdentityType: protocol.ScoreboardIdentityPlayer, EntityUniqueID: u},
+			{IdentityType: protocol.ScoreboardIdentityEntity, EntityUniqueID: u},
+		}}
+	},
+	"SetScoreboardIdentity": func(r uint64, u int64) packet.Packet {
+		return &packet.SetScoreboardIdentity{
+			ActionType: packet.ScoreboardIdentityActionRegister,
+			Entries:    []protocol.ScoreboardIdentityEntry{{EntityUniqueID: u}},
+		}
+	},
+	"ShowCredits": func(r uint64, u int64) packet.Packet {
+		return &packet.ShowCredits{PlayerRuntimeID: r}
+	},
+	"SpawnParticleEffect": func(r uint64, u int64) packet.Packet {
+		return &packet.SpawnParticleEffect{EntityUniqueID: u}
+	},
+	"StartGame": func(r uint64, u int64) packet.Packet {
+		return &packet.StartGame{EntityUniqueID: u, EntityRuntimeID: r}
+	},
+	"StructureBlockUpdate": func(r uint64, u int64) packet.Packet {
+		return &packet.StructureBlockUpdate{Settings: protocol.StructureSettings{LastEditingPlayerUniqueID: u}}
+	},
+	"StructureTemplateDataRequest": func(r uint64, u int64) packet.Packet {
+		return &packet.StructureTemplateDataRequest{Settings: protocol.StructureSettings{LastEditingPlayerUniqueID: u}}
+	},
+	"TakeItemActor": func(r uint64, u int64) packet.Packet {
+		return &packet.TakeItemActor{ItemEntityRuntimeID: r, TakerEntityRuntimeID: r}
+	},
+	"UpdateAbilities": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateAbilities{AbilityData: protocol.AbilityData{EntityUniqueID: u}}
+	},
+	"UpdateAttributes": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateAttributes{EntityRuntimeID: r}
+	},
+	"UpdateBlockSynced": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateBlockSynced{EntityUniqueID: uint64(u)}
+	},
+	"UpdateEquip": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateEquip{EntityUniqueID: u}
+	},
+	"UpdatePlayerGameType": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdatePlayerGameType{PlayerUniqueID: u}
+	},
+	"UpdateSubChunkBlocks": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateSubChunkBlocks{
+			Blocks: []protocol.BlockChangeEntry{{SyncedUpdateEntityUniqueID: uint64(u)}},
+			Extra:  []protocol.BlockChangeEntry{{SyncedUpdateEntityUniqueID: uint64(u)}},
+		}
+	},
+	"UpdateTrade": func(r uint64, u int64) packet.Packet {
+		return &packet.UpdateTrade{VillagerUniqueID: u, EntityUniqueID: u}
+	},
+}
+
+// testMetadata returns entity metadata holding the IDs passed in every key that translateMetadata translates,
+// along with a key that must never be translated.
+func testMetadata(r uint64, u int64) map[uint32]any {
+	return map[uint32]any{
+		protocol.EntityDataKeyOwner:         u,
+		protocol.EntityDataKeyTarget:        u,
+		protocol.EntityDataKeyDisplayOffset: u,
+		protocol.EntityDataKeyLeashHolder:   u,
+		protocol.EntityDataKeyAgent:         u,
+		protocol.EntityDataKeyBaseRuntimeID: r,
+		protocol.EntityDataKeyVariant:       int32(1),
+	}
+}
+
+func newTestConn() *conn {
+	return &conn{
+		runtimeID: testRuntimeID,
+		uniqueID:  testUniqueID,
+		log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestTranslatePacket(t *testing.T) {
+	c := newTestConn()
+	for name, build := range translateCases {
+		t.Run(name, func(t *testing.T) {
+			// The server refers to the player as 1, the proxy by the IDs sent in the ConnectionResponse.
+			if got, want := c.translatePacket(build(1, 1), true), build(testRuntimeID, testUniqueID); !reflect.DeepEqual(got, want) {
+				t.Errorf("server sent: got %+v, want %+v", got, want)
+			}
+			if got, want := c.translatePacket(build(testRuntimeID, testUniqueID), false), build(1, 1); !reflect.DeepEqual(got, want) {
+				t.Errorf("client sent: got %+v, want %+v", got, want)
+			}
+
+			got := c.translatePacket(c.translatePacket(build(1, 1), true), false)
+			if want := build(1, 1); !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip: got %+v, want %+v", got, want)
+			}
+
+			for _, serverSent := range []bool{true, false} {
+				if got, want := c.translatePacket(build(otherID, otherID), serverSent), build(otherID, otherID); !reflect.DeepEqual(got, want) {
+					t.Errorf("other entity (server sent %v): got %+v, want %+v", serverSent, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestTranslatePacketConditional checks that IDs in fields that only refer to an entity under certain
+// conditions are left alone if the conditions are not met.
+func TestTranslatePacketConditional(t *testing.T) {
+	c := newTestConn()
+	for _, pk := range []packet.Packet{
+		&packet.CommandBlockUpdate{Block: true, MinecartEntityRuntimeID: 1},
+		&packet.PlayerAuthInput{InputData: protocol.NewBitset(packet.PlayerAuthInputBitsetSize), ClientPredictedVehicle: 1},
+		&packet.SetScore{Entries: []protocol.ScoreboardEntry{{IdentityType: protocol.ScoreboardIdentityFakePlayer, EntityUniqueID: 1}}},
+		&packet.SetScoreboardIdentity{
+			ActionType: packet.ScoreboardIdentityActionClear,
+			Entries:    []protocol.ScoreboardIdentityEntry{{EntityUniqueID: 1}},
+		},
+	} {
+		want := reflect.ValueOf(pk).Elem().Interface()
+		if got := reflect.ValueOf(c.translatePacket(pk, true)).Elem().Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%T: got %+v, want %+v", pk, got, want)
+		}
+	}
+}
+
+// TestTranslatePacketCases checks that translateCases holds a case for every packet handled by translatePacket,
+// so that newly handled packets cannot go untested.
+func TestTranslatePacketCases(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "conn.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var handled []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FuncDecl)
+		if !ok || fn.Name.Name != "translatePacket" {
+			return true
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			clause, ok := n.(*ast.CaseClause)
+			if !ok {
+				return true
+			}
+
+			for _, expr := range clause.List {
+				star, ok := expr.(*ast.StarExpr)
+				if !ok {
+					continue
+				}
+				if sel, ok := star.X.(*ast.SelectorExpr); ok && sel.X.(*ast.Ident).Name == "packet" {
+					handled = append(handled, sel.Sel.Name)
+				}
+			}
+			return true
+		})
+		return false
+	})
+	if len(handled) == 0 {
+		t.Fatal("no packets found in translatePacket")
+	}
+
+	for _, name := range handled {
+		if _, ok := translateCases[name]; !ok {
+			t.Errorf("no test case for packet %v", name)
+		}
+	}
+	for name := range translateCases {
+		if !slices.Contains(handled, name) {
+			t.Errorf("test case for packet %v, which translatePacket does not handle", name)
+		}
+	}
+}
+
+// newFuzzConn returns a connection reading frames from the data passed.
+func newFuzzConn(data []byte) *conn {
+	c := newTestConn()
+	c.conn = struct {
+		io.Reader
+		io.WriteCloser
+	}{Reader: bytes.NewReader(data)}
+	c.pool = dfpacket.NewClientPool()
+	c.closed = make(chan struct{})
+	c.listener = &Listener{
+		metrics:             metrics.NopCollector{},
+		log:                 c.log,
+		skipUnknownPackets:  true,
+		maxDecodeFailures:   8,
+		maxCompressedSize:   1024 * 1024,
+		maxDecompressedSize: 1024 * 1024,
+	}
+	return c
+}
+
+// encodeFrames encodes the packets passed into frames as they are sent by the proxy.
+func encodeFrames(pks ...packet.Packet) []byte {
+	stream := bytes.NewBuffer(nil)
+	writer := spectrumprotocol.NewWriter(stream)
+	for _, pk := range pks {
+		buf := bytes.NewBuffer(nil)
+		_ = (&packet.Header{PacketID: pk.ID()}).Write(buf)
+		pk.Marshal(protocol.NewWriter(buf, 0))
+		_ = writer.Write(snappy.Encode(nil, buf.Bytes()))
+	}
+	return stream.Bytes()
+}
+
+func FuzzRead(f *testing.F) {
+	f.Add(encodeFrames(&packet.Text{TextType: packet.TextTypeChat, Message: "hello"}))
+	f.Add(encodeFrames(&packet.MovePlayer{EntityRuntimeID: testRuntimeID}, &packet.Animate{EntityRuntimeID: 1}))
+	f.Add(encodeFrames(&packet.PlayerAuthInput{InputData: protocol.NewBitset(packet.PlayerAuthInputBitsetSize)}))
+	f.Add([]byte{0, 0, 0, 3, 0xff, 0xff, 0xff})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte("\x00\x00\x00\x10\x0e4D0\xff\xff\xff\xff00000000"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := newFuzzConn(data)
+		for range 64 {
+			pk, err := c.read()
+			if err != nil {
+				return
+			}
+			if pk == nil {
+				t.Fatal("read returned neither a packet nor an error")
+			}
+		}
+	})
+}
+
+// closeHandler counts the connections closed.
+type closeHandler struct {
+	NopListenerHandler
+	closes atomic.Int32
+}
+
+// HandleClose ...
+func (h *closeHandler) HandleClose(session.Conn, error) {
+	h.closes.Add(1)
+}
+
+// TestCloseConcurrent checks that a connection closed from several goroutines at once is torn down exactly once.
+func TestCloseConcurrent(t *testing.T) {
+	for range 1000 {
+		handler := &closeHandler{}
+		c := newTestConn()
+		c.closed = make(chan struct{})
+		c.listener = &Listener{metrics: metrics.NopCollector{}, handler: handler, registry: newRegistry()}
+		c.streams = []*stream{newStream(c, struct {
+			io.Reader
+			io.WriteCloser
+		}{Reader: bytes.NewReader(nil), WriteCloser: nopWriteCloser{}})}
+		c.established.Store(true)
+		c.listener.registry.add(c)
+
+		var (
+			wg     sync.WaitGroup
+			start  = make(chan struct{})
+			closed atomic.Int32
+		)
+		for range 4 {
+			wg.Go(func() {
+				<-start
+				if c.Close() == nil {
+					closed.Add(1)
+				}
+			})
+		}
+		close(start)
+		wg.Wait()
+		if n := closed.Load(); n != 1 {
+			t.Fatalf("%v calls to Close succeeded, want 1", n)
+		}
+		if n := handler.closes.Load(); n != 1 {
+			t.Fatalf("HandleClose called %v times, want 1", n)
+		}
+	}
+}
+
+// nopWriteCloser discards everything written to it.
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(b []byte) (int, error) { return len(b), nil }
+func (nopWriteCloser) Close() error                { return nil }
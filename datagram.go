@@ -0,0 +1,67 @@
+package spectrum
+
+import (
+	"encoding/binary"
+
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	tr "github.com/cooldogedev/spectrum-df/transport"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// datagramPackets holds the IDs of the packets sent as unreliable datagrams if ListenConfig.Datagrams is set.
+// These packets are sent often and every one of them supersedes the previous one for the same entity, so losing
+// one is preferable over holding up the packets sent after it. MoveActorDelta is not one of them, as it only
+// holds the fields that changed since the previous movement, which would be lost with it.
+var datagramPackets = map[uint32]struct{}{
+	packet.IDMoveActorAbsolute: {},
+	packet.IDSetActorMotion:    {},
+}
+
+// datagramPacket checks if the packet passed may be sent as a datagram. Teleports are always written to the
+// stream, as they are not superseded by the movement following them.
+func datagramPacket(pk packet.Packet) bool {
+	if _, ok := datagramPackets[pk.ID()]; !ok {
+		return false
+	}
+	if pk, ok := pk.(*packet.MoveActorAbsolute); ok && pk.Flags&packet.MoveFlagTeleport != 0 {
+		return false
+	}
+	return true
+}
+
+// enableDatagrams answers the DatagramRequest of the proxy. Datagrams are only enabled if the Listener is
+// configured to send them and the stream of the connection supports it, otherwise the proxy is told that all
+// packets are sent over the stream.
+func (c *conn) enableDatagrams() error {
+	sender, ok := c.conn.(tr.DatagramSender)
+	if !ok || !c.listener.datagrams || !sender.SupportsDatagrams() {
+		return c.WritePacket(&dfpacket.DatagramResponse{})
+	}
+
+	id := c.listener.datagramID.Add(1)
+	if err := c.WritePacket(&dfpacket.DatagramResponse{DatagramID: id}); err != nil {
+		return err
+	}
+	c.datagrams, c.datagramID = sender, id
+	return nil
+}
+
+// sendDatagram sends a frame holding the packet passed as a datagram if datagrams are enabled and the packet
+// may be sent as one. It returns false if the frame should be written to the stream instead, for example because
+// it is too large to fit in a single datagram.
+func (c *conn) sendDatagram(pk packet.Packet, frame *[]byte) bool {
+	if c.datagrams == nil || !datagramPacket(pk) {
+		return false
+	}
+
+	datagram := getFrame(4 + len(*frame))
+	defer putFrame(datagram)
+	binary.BigEndian.PutUint32(*datagram, c.datagramID)
+	copy((*datagram)[4:], *frame)
+	if err := c.datagrams.SendDatagram(*datagram); err != nil {
+		c.log.Debug("failed to send datagram, writing to stream instead", "id", pk.ID(), "err", err)
+		return false
+	}
+	putFrame(frame)
+	return true
+}
@@ -0,0 +1,69 @@
+package spectrum
+
+import (
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	"github.com/df-mc/dragonfly/server/session"
+)
+
+// DisconnectReason is a machine-readable reason for disconnecting a player, sent to the proxy so that it can
+// decide between kicking the player and routing them to another server.
+type DisconnectReason uint8
+
+const (
+	// DisconnectReasonUnspecified is used for players disconnected without a more specific reason, such as
+	// players kicked through their session directly.
+	DisconnectReasonUnspecified DisconnectReason = dfpacket.DisconnectReasonUnspecified
+	// DisconnectReasonKicked means the player was deliberately removed from the server.
+	DisconnectReasonKicked DisconnectReason = dfpacket.DisconnectReasonKicked
+	// DisconnectReasonServerFull means the server cannot accept the player right now.
+	DisconnectReasonServerFull DisconnectReason = dfpacket.DisconnectReasonServerFull
+	// DisconnectReasonShuttingDown means the server is shutting down and the player should be rerouted.
+	DisconnectReasonShuttingDown DisconnectReason = dfpacket.DisconnectReasonShuttingDown
+	// DisconnectReasonDuplicateLogin means the player logged in from another location.
+	DisconnectReasonDuplicateLogin DisconnectReason = dfpacket.DisconnectReasonDuplicateLogin
+)
+
+// DisconnectError is the reason passed to ListenerHandler.HandleClose for connections that were sent a
+// Disconnect packet by the server before being closed.
+type DisconnectError struct {
+	// Reason is the reason sent to the proxy.
+	Reason DisconnectReason
+	// Message is the message the player was disconnected with.
+	Message string
+}
+
+// Error ...
+func (err DisconnectError) Error() string {
+	if err.Message == "" {
+		return "disconnected by server"
+	}
+	return "disconnected by server: " + err.Message
+}
+
+// DisconnectWithReason disconnects a connection of the Listener with the reason and message passed. The reason
+// is sent to the proxy ahead of the Minecraft Disconnect packet, which carries the message shown to the player,
+// if the proxy requested disconnect reasons during the handshake.
+func (l *Listener) DisconnectWithReason(c session.Conn, reason DisconnectReason, message string) error {
+	if sc, ok := c.(*conn); ok {
+		sc.disconnectReason(reason, message)
+	}
+	return l.Disconnect(c, message)
+}
+
+// disconnectReason sends the reason the connection is about to be disconnected for to the proxy, if it requested
+// disconnect reasons. It is only sent once, so that the reason of the first disconnect is the one the proxy acts
+// upon.
+func (c *conn) disconnectReason(reason DisconnectReason, message string) {
+	if c.disconnecting.Swap(true) {
+		return
+	}
+
+	c.setCloseReason(DisconnectError{Reason: reason, Message: message})
+	if !c.disconnectReasons {
+		return
+	}
+
+	if err := c.WritePacket(&dfpacket.Disconnect{Reason: uint8(reason), Message: message}); err != nil {
+		c.log.Debug("failed to send disconnect reason", "err", err)
+	}
+}
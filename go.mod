@@ -6,6 +6,7 @@ require (
 	github.com/brentp/intintmap v0.0.0-20251106190759-56907b1f8479
 	github.com/cooldogedev/spectral v0.0.5
 	github.com/cooldogedev/spectrum v0.0.44
+	github.com/coreos/go-oidc/v3 v3.20.0
 	github.com/df-mc/dragonfly v0.11.0
 	github.com/golang/snappy v1.0.0
 	github.com/google/uuid v1.6.0
@@ -15,7 +16,6 @@ require (
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
-	github.com/coreos/go-oidc/v3 v3.20.0 // indirect
 	github.com/df-mc/go-nethernet v1.0.18 // indirect
 	github.com/df-mc/go-playfab v1.0.0 // indirect
 	github.com/df-mc/go-xsapi v1.0.1 // indirect
@@ -0,0 +1,41 @@
+package spectrum
+
+import (
+	"time"
+
+	tr "github.com/cooldogedev/spectrum-df/transport"
+	"github.com/df-mc/dragonfly/server/session"
+)
+
+// ListenerHandler handles events related to the lifecycle of the connections of a Listener. Its methods are
+// called from the goroutines of the connections themselves, so implementations must be safe for concurrent use
+// and should not block for long.
+type ListenerHandler interface {
+	// HandleStreamAccept handles a new stream being accepted from the proxy, before its handshake is performed.
+	// The information passed holds the address of the proxy that opened the stream.
+	HandleStreamAccept(info tr.StreamInfo)
+	// HandleHandshake handles a connection completing its handshake. The ClientData and IdentityData sent by
+	// the proxy are available through the connection passed.
+	HandleHandshake(conn session.Conn)
+	// HandleHandshakeFail handles a stream failing to complete its handshake. The stream is closed right after.
+	HandleHandshakeFail(info tr.StreamInfo, err error)
+	// HandleClose handles a connection that completed its handshake being closed. The reason is nil if the
+	// connection was closed by the server without a more specific reason.
+	HandleClose(conn session.Conn, reason error)
+	// HandleLatency handles the latency of a connection being updated by the proxy.
+	HandleLatency(conn session.Conn, latency time.Duration)
+}
+
+// NopListenerHandler implements the ListenerHandler interface but does not execute any code when an event is
+// called. The default handler of a Listener is a NopListenerHandler. Users may embed NopListenerHandler to avoid
+// having to implement each method.
+type NopListenerHandler struct{}
+
+// Compile time check to make sure NopListenerHandler implements ListenerHandler.
+var _ ListenerHandler = NopListenerHandler{}
+
+func (NopListenerHandler) HandleStreamAccept(tr.StreamInfo)          {}
+func (NopListenerHandler) HandleHandshake(session.Conn)              {}
+func (NopListenerHandler) HandleHandshakeFail(tr.StreamInfo, error)  {}
+func (NopListenerHandler) HandleClose(session.Conn, error)           {}
+func (NopListenerHandler) HandleLatency(session.Conn, time.Duration) {}
@@ -1,33 +1,400 @@
 package spectrum
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cooldogedev/spectrum-df/metrics"
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
 	tr "github.com/cooldogedev/spectrum-df/transport"
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
 	"github.com/df-mc/dragonfly/server/session"
+	"github.com/google/uuid"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// ListenConfig holds the settings that may be used to create a Listener with additional options.
+type ListenConfig struct {
+	// Transport is the transport used to accept streams from the proxy. If left nil, the Spectral transport
+	// is used.
+	Transport tr.Transport
+	// Secret is a secret shared with the proxy. If non-empty, every stream has to complete a challenge-response
+	// handshake proving knowledge of the secret before its ConnectionRequest is trusted. Streams failing to do
+	// so are closed before they are ever returned from Accept.
+	Secret []byte
+	// HandshakeTimeout is the maximum time a stream may take to complete its handshake, from being accepted to
+	// sending its ConnectionRequest. Streams exceeding it are closed, so that a proxy that stops sending cannot
+	// hold on to them forever. If left 0, DefaultHandshakeTimeout is used.
+	HandshakeTimeout time.Duration
+	// MaxHandshakes is the maximum number of streams that may perform their handshake at the same time. Streams
+	// that completed their handshake count towards it until they are returned from Accept. Once it is reached, no
+	// further streams are accepted until a stream is returned from Accept or fails its handshake, leaving them in
+	// the queue of the transport, where its QueuePolicy applies. If left 0, DefaultMaxHandshakes is used.
+	MaxHandshakes int
+	// Filter restricts the remote addresses allowed to connect to the transport, for example to the addresses
+	// of the proxies only. If left nil, connections from any address are accepted. The Transport must implement
+	// a SetFilter(*transport.Filter) method if a Filter is set.
+	Filter *tr.Filter
+	// ShutdownTransferAddr is the address of the server that players are transferred to by the proxy when the
+	// Listener is shut down using Shutdown. If left empty, players are disconnected with ShutdownMessage instead.
+	ShutdownTransferAddr string
+	// ShutdownMessage is the message players are disconnected with when the Listener is shut down using Shutdown
+	// and no ShutdownTransferAddr is set.
+	ShutdownMessage string
+	// DuplicateLoginPolicy specifies what happens when a player logs in while a connection with the same XUID is
+	// still online. By default, the connection that was already online is kicked.
+	DuplicateLoginPolicy DuplicateLoginPolicy
+	// Metrics is the Collector that measurements of the Listener and its connections are reported to, such as
+	// a *metrics.Metrics. If left nil, no measurements are taken.
+	Metrics metrics.Collector
+	// Log is the logger used by the Listener, its connections and its transport, if the Transport implements a
+	// SetLogger(*slog.Logger) method. If left nil, slog.Default() is used.
+	Log *slog.Logger
+	// Handler is the ListenerHandler that handles the lifecycle events of the connections of the Listener. If
+	// left nil, a NopListenerHandler is used.
+	Handler ListenerHandler
+	// Capture, if non-nil, enables capturing the frames exchanged with the proxy for debugging. It is called for
+	// every connection that completes its handshake and returns the writer its frames are captured to. Captures
+	// may be replayed using capture.NewReplayTransport.
+	Capture CaptureFunc
+	// SkipUnknownPackets specifies if packets with an unknown ID are logged and skipped rather than closing the
+	// connection they were read from.
+	SkipUnknownPackets bool
+	// MaxDecodeFailures is the number of packets per connection that may fail to decode, for example because
+	// decoding panicked, before the connection is closed. Packets failing to decode within this limit are logged
+	// and skipped. By default, the first such packet closes the connection.
+	MaxDecodeFailures int
+	// MaxDecompressedSize is the maximum size of a frame read from the proxy after decompression. Frames
+	// exceeding it close the connection before any memory is allocated for them. It does not bound the memory
+	// allocated when decoding the packet a frame holds, as byte slices and strings in a packet are allocated
+	// with the length they are prefixed with. If left 0, DefaultMaxDecompressedSize is used.
+	MaxDecompressedSize int
+	// MaxCompressedSize is the maximum size of a frame read from the proxy before decompression. Frames
+	// exceeding it close the connection as soon as their length is read, before any memory is allocated for
+	// them. If left 0, DefaultMaxCompressedSize is used.
+	MaxCompressedSize int
+	// WriteQueueSize is the number of frames per connection that may be queued to be written to the proxy. If
+	// left 0, DefaultWriteQueueSize is used.
+	WriteQueueSize int
+	// WriteTimeout is the maximum time spent writing a frame to the proxy, and the maximum time a write waits
+	// for space in a full write queue before the connection is closed. Write deadlines are only applied if the
+	// stream of the transport supports them. If left 0, DefaultWriteTimeout is used.
+	WriteTimeout time.Duration
+	// Priorities maps packet IDs to the Priority they are written to the proxy with. Packets without an entry
+	// are of PriorityNormal. If left nil, DefaultPriorities is used. Setting it to an empty map writes all
+	// packets in the order they are written in. Packets of different priorities may be reordered relative to
+	// each other, so packets that depend on each other, such as AddActor and the movement of that actor, should
+	// be given the same priority.
+	//
+	// The defaults only raise the latency packets of the proxy, so chunks are of PriorityNormal and still hold
+	// up the movement written after them. Keeping world data from delaying other packets must be configured
+	// explicitly, for example by lowering chunks together with the block updates that depend on them and
+	// writing them to a separate stream:
+	//
+	//	Priorities: map[uint32]spectrum.Priority{
+	//		packet.IDLevelChunk:           spectrum.PriorityLow,
+	//		packet.IDSubChunk:             spectrum.PriorityLow,
+	//		packet.IDUpdateBlock:          spectrum.PriorityLow,
+	//		packet.IDUpdateSubChunkBlocks: spectrum.PriorityLow,
+	//	},
+	//	Streams: []spectrum.Priority{spectrum.PriorityLow},
+	Priorities map[uint32]Priority
+	// Streams holds the priorities of the packets that are written to additional streams, one stream per
+	// priority, for proxies that request them during the handshake. This allows packet loss on bulk world data
+	// to not hold up latency sensitive packets, but is only supported by transports opening streams that
+	// implement transport.StreamOpener, such as QUIC. If left empty, which is the default, all packets are
+	// written to a single stream and priorities only reorder packets that are queued at the same time.
+	// PriorityNormal is always written to the main stream and may not be part of Streams.
+	Streams []Priority
+	// Datagrams specifies if packets that are sent often and superseded by the next packet of the same kind,
+	// such as entity movement, are sent as unreliable datagrams for proxies that request them during the
+	// handshake. This avoids lost movement holding up other packets, but is only supported by transports
+	// opening streams that implement transport.DatagramSender, such as QUIC.
+	Datagrams bool
+	// StartGame, if non-nil, is called with the StartGame packet of every connection right before it is written,
+	// allowing fields that are otherwise set to fixed values to be changed.
+	StartGame StartGameFunc
+	// ResourcePacks holds the resource packs advertised to proxies that request them during the handshake, so
+	// that they can be offered to players joining through the proxy. Usually, these are the Resources of the
+	// server.Config of the server.
+	ResourcePacks []*resource.Pack
+	// TexturePacksRequired specifies if players must download the ResourcePacks in order to join.
+	TexturePacksRequired bool
+	// LoginVerification specifies how the identity of players sent by the proxy is verified. By default, the
+	// IdentityData sent by the proxy is trusted.
+	LoginVerification LoginVerification
+	// ProxyKey is the public key of the proxy that login requests are verified against if LoginVerification is
+	// LoginVerificationProxyKey. Login requests signed with it are accepted on any stream until they expire, so
+	// the private key should only be held by the proxy.
+	ProxyKey *ecdsa.PublicKey
+	// Status, if non-nil, is called every time the Status of the Listener is reported to the proxy, allowing
+	// fields the Listener cannot know itself, such as the tick time, to be filled in.
+	Status StatusFunc
+	// StatusInterval is the interval at which the Status of the Listener is sent to proxies that requested
+	// updates. Each proxy requesting updates keeps a stream open for them, which does not count towards the
+	// HandshakeTimeout or MaxHandshakes. If left 0, the Status is only sent when requested, and requests for
+	// updates are answered once like any other request.
+	StatusInterval time.Duration
+}
+
+const (
+	// DefaultHandshakeTimeout is the default maximum time a stream may take to complete its handshake.
+	DefaultHandshakeTimeout = 10 * time.Second
+	// DefaultMaxHandshakes is the default maximum number of streams performing their handshake at the same time.
+	DefaultMaxHandshakes = 64
+	// DefaultMaxDecompressedSize is the default maximum size of a frame read from the proxy after decompression.
+	DefaultMaxDecompressedSize = 16 * 1024 * 1024
+	// DefaultMaxCompressedSize is the default maximum size of a frame read from the proxy before decompression.
+	DefaultMaxCompressedSize = 16 * 1024 * 1024
+	// DefaultWriteQueueSize is the default number of frames per connection that may be queued to be written.
+	DefaultWriteQueueSize = 256
+	// DefaultWriteTimeout is the default maximum time spent writing a frame to the proxy.
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// DuplicateLoginPolicy specifies how a Listener handles a player logging in with the XUID of a player that is
+// already online.
+type DuplicateLoginPolicy uint8
+
+const (
+	// DuplicateLoginKickOld kicks the connection that was already online in favour of the new one.
+	DuplicateLoginKickOld DuplicateLoginPolicy = iota
+	// DuplicateLoginRejectNew rejects the new connection, keeping the one that was already online.
+	DuplicateLoginRejectNew
+)
+
+var (
+	errListenerClosed   = errors.New("closed listener")
+	errDuplicateLogin   = errors.New("duplicate login")
+	errHandshakeTimeout = errors.New("handshake timed out")
 )
 
 type Listener struct {
-	transport tr.Transport
+	transport  tr.Transport
+	pool       packet.Pool
+	secret     []byte
+	incoming   chan *conn
+	handshakes chan struct{}
+	closed     chan struct{}
+
+	handshakeTimeout     time.Duration
+	shutdownTransferAddr string
+	shutdownMessage      string
+	duplicateLoginPolicy DuplicateLoginPolicy
+	metrics              metrics.Collector
+	log                  *slog.Logger
+	handler              ListenerHandler
+	capture              CaptureFunc
+	skipUnknownPackets   bool
+	maxDecodeFailures    int
+	maxDecompressedSize  int
+	maxCompressedSize    int
+	writeQueueSize       int
+	writeTimeout         time.Duration
+	priorities           map[uint32]Priority
+	streams              []Priority
+	datagrams            bool
+	startGame            StartGameFunc
+	resourcePacks        []*resource.Pack
+	texturePacksRequired bool
+	verifyLogin          loginVerifier
+	status               StatusFunc
+	statusInterval       time.Duration
+
+	registry   *registry
+	datagramID atomic.Uint32
+	mu         sync.Mutex
+
+	statusMu      sync.Mutex
+	statusStreams map[*conn]struct{}
 }
 
 func NewListener(addr string, transport tr.Transport) (*Listener, error) {
-	if transport == nil {
-		transport = tr.NewSpectral()
+	return ListenConfig{Transport: transport}.Listen(addr)
+}
+
+// Listen creates a Listener using the settings of the ListenConfig and starts listening on the address passed.
+func (cfg ListenConfig) Listen(addr string) (*Listener, error) {
+	if cfg.Transport == nil {
+		cfg.Transport = tr.NewSpectral()
+	}
+
+	if cfg.Log == nil {
+		cfg.Log = slog.Default()
+	}
+	cfg.Log = cfg.Log.With("transport", transportName(cfg.Transport))
+	if t, ok := cfg.Transport.(interface{ SetLogger(*slog.Logger) }); ok {
+		t.SetLogger(cfg.Log)
+	}
+
+	if cfg.Handler == nil {
+		cfg.Handler = NopListenerHandler{}
+	}
+
+	if cfg.HandshakeTimeout <= 0 {
+		cfg.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+
+	if cfg.MaxHandshakes <= 0 {
+		cfg.MaxHandshakes = DefaultMaxHandshakes
+	}
+
+	if cfg.MaxDecompressedSize <= 0 {
+		cfg.MaxDecompressedSize = DefaultMaxDecompressedSize
+	}
+
+	if cfg.MaxCompressedSize <= 0 {
+		cfg.MaxCompressedSize = DefaultMaxCompressedSize
 	}
 
-	if err := transport.Listen(addr); err != nil {
+	if cfg.WriteQueueSize <= 0 {
+		cfg.WriteQueueSize = DefaultWriteQueueSize
+	}
+
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWriteTimeout
+	}
+
+	if cfg.Priorities == nil {
+		cfg.Priorities = defaultPriorities
+	}
+
+	verifyLogin, err := newLoginVerifier(cfg.LoginVerification, cfg.ProxyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, priority := range cfg.Streams {
+		if priority >= priorityCount || priority == PriorityNormal {
+			return nil, fmt.Errorf("invalid stream priority %v", priority)
+		}
+		if slices.Contains(cfg.Streams[:i], priority) {
+			return nil, fmt.Errorf("duplicate stream priority %v", priority)
+		}
+	}
+
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.NopCollector{}
+	}
+	if t, ok := cfg.Transport.(interface{ SetMetrics(metrics.Collector) }); ok {
+		t.SetMetrics(cfg.Metrics)
+	}
+
+	if cfg.Filter != nil {
+		t, ok := cfg.Transport.(interface{ SetFilter(*tr.Filter) })
+		if !ok {
+			return nil, fmt.Errorf("transport %v does not support filters", transportName(cfg.Transport))
+		}
+		t.SetFilter(cfg.Filter)
+	}
+
+	if err := cfg.Transport.Listen(addr); err != nil {
 		return nil, err
 	}
-	return &Listener{transport: transport}, nil
+
+	l := &Listener{
+		transport:  cfg.Transport,
+		pool:       dfpacket.NewClientPool(),
+		secret:     cfg.Secret,
+		incoming:   make(chan *conn),
+		handshakes: make(chan struct{}, cfg.MaxHandshakes),
+		closed:     make(chan struct{}),
+
+		handshakeTimeout:     cfg.HandshakeTimeout,
+		shutdownTransferAddr: cfg.ShutdownTransferAddr,
+		shutdownMessage:      cfg.ShutdownMessage,
+		duplicateLoginPolicy: cfg.DuplicateLoginPolicy,
+		metrics:              cfg.Metrics,
+		log:                  cfg.Log,
+		handler:              cfg.Handler,
+		capture:              cfg.Capture,
+		skipUnknownPackets:   cfg.SkipUnknownPackets,
+		maxDecodeFailures:    cfg.MaxDecodeFailures,
+		maxDecompressedSize:  cfg.MaxDecompressedSize,
+		maxCompressedSize:    cfg.MaxCompressedSize,
+		writeQueueSize:       cfg.WriteQueueSize,
+		writeTimeout:         cfg.WriteTimeout,
+		priorities:           maps.Clone(cfg.Priorities),
+		streams:              slices.Clone(cfg.Streams),
+		datagrams:            cfg.Datagrams,
+		startGame:            cfg.StartGame,
+		resourcePacks:        slices.Clone(cfg.ResourcePacks),
+		texturePacksRequired: cfg.TexturePacksRequired,
+		verifyLogin:          verifyLogin,
+		status:               cfg.Status,
+		statusInterval:       cfg.StatusInterval,
+
+		registry:      newRegistry(),
+		statusStreams: make(map[*conn]struct{}),
+	}
+	listeners.Store(l, struct{}{})
+	go l.listen()
+	if l.statusInterval > 0 {
+		go l.reportStatus()
+	}
+	return l, nil
 }
 
 // Accept ...
 func (l *Listener) Accept() (session.Conn, error) {
-	c, err := l.transport.Accept()
-	if err != nil {
-		return nil, err
+	select {
+	case <-l.closed:
+		return nil, errListenerClosed
+	case c := <-l.incoming:
+		return c, nil
 	}
-	return newConn(c, packet.NewClientPool())
+}
+
+// ConnByXUID returns the connection of the player with the XUID passed, if it is online.
+func (l *Listener) ConnByXUID(xuid string) (Conn, bool) {
+	return lookup(l.registry.xuid(xuid))
+}
+
+// ConnByUUID returns the connection of the player with the UUID passed, if it is online.
+func (l *Listener) ConnByUUID(id uuid.UUID) (Conn, bool) {
+	return lookup(l.registry.uuid(id))
+}
+
+// ConnByRuntimeID returns the connection of the player with the runtime ID passed, as sent to the proxy in the
+// ConnectionResponse, if it is online.
+func (l *Listener) ConnByRuntimeID(id uint64) (Conn, bool) {
+	return lookup(l.registry.runtimeID(id))
+}
+
+// Conns returns an iterator over the connections of all players that are currently online.
+func (l *Listener) Conns() iter.Seq[Conn] {
+	return func(yield func(Conn) bool) {
+		for _, c := range l.registry.all() {
+			if !yield(c) {
+				return
+			}
+		}
+	}
+}
+
+// Addr returns the address the transport of the Listener listens on, or nil if the transport does not expose it.
+func (l *Listener) Addr() net.Addr {
+	if t, ok := l.transport.(interface{ Addr() net.Addr }); ok {
+		return t.Addr()
+	}
+	return nil
+}
+
+// Count returns the number of players that are currently online.
+func (l *Listener) Count() int {
+	return l.registry.len()
 }
 
 // Disconnect ...
@@ -41,5 +408,224 @@ func (l *Listener) Disconnect(conn session.Conn, reason string) error {
 
 // Close ...
 func (l *Listener) Close() error {
+	if _, err := l.stopAccepting(); err != nil {
+		return err
+	}
+	listeners.Delete(l)
+	l.closeStatusStreams()
+	return l.transport.Close()
+}
+
+// Shutdown gracefully shuts down the Listener. It stops accepting new streams, transfers every online player to
+// the configured ShutdownTransferAddr (or disconnects them with the ShutdownMessage) and waits for all of their
+// connections to close before closing the transport. Streams accepted in the meantime are closed before their
+// handshake, and streams that were still performing their handshake are transferred like the online players. If
+// the context passed is done before that, the remaining connections are closed forcibly and the context's error
+// is returned.
+func (l *Listener) Shutdown(ctx context.Context) error {
+	conns, err := l.stopAccepting()
+	if err != nil {
+		return err
+	}
+
+	// Proxies that requested status updates are told right away that no new players are accepted, before
+	// the players are transferred away.
+	l.sendStatus()
+	for _, c := range conns {
+		l.shutdownConn(c)
+	}
+
+	select {
+	case <-l.registry.wait():
+	case <-ctx.Done():
+		l.log.Warn("shutdown deadline exceeded, closing remaining connections", "remaining", l.registry.len())
+		for _, c := range l.registry.all() {
+			_ = c.Close()
+		}
+		listeners.Delete(l)
+		l.closeStatusStreams()
+		_ = l.transport.Close()
+		return ctx.Err()
+	}
+	listeners.Delete(l)
+	l.closeStatusStreams()
 	return l.transport.Close()
 }
+
+// shutdownConn transfers a connection to the ShutdownTransferAddr, or disconnects it with the ShutdownMessage
+// if none is set. Connections are only shut down once, so that the proxy is never sent a second Transfer.
+func (l *Listener) shutdownConn(c *conn) {
+	if c.shutdown.Swap(true) {
+		return
+	}
+
+	if l.shutdownTransferAddr != "" {
+		if err := c.WritePacket(&spectrumpacket.Transfer{Addr: l.shutdownTransferAddr}); err != nil {
+			c.log.Debug("failed to transfer player on shutdown", "err", err)
+		}
+	} else {
+		_ = l.DisconnectWithReason(c, DisconnectReasonShuttingDown, l.shutdownMessage)
+	}
+}
+
+// stopAccepting stops the Listener from accepting any new connections and returns the connections that are
+// currently online.
+func (l *Listener) stopAccepting() ([]*conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.closed:
+		return nil, errors.New("already closed")
+	default:
+		close(l.closed)
+	}
+	return l.registry.all(), nil
+}
+
+// add adds a connection that completed its handshake to the registry and makes its cache available through
+// GetCache. If a connection with the same XUID is already online, the DuplicateLoginPolicy of the Listener
+// decides which of the two is kept. Connections without an XUID are never considered duplicates. An error is
+// returned if the connection passed was not added.
+func (l *Listener) add(c *conn) error {
+	l.mu.Lock()
+	select {
+	case <-l.closed:
+		l.mu.Unlock()
+		return errListenerClosed
+	default:
+	}
+
+	if _, ok := l.registry.xuid(c.identityData.XUID); ok && l.duplicateLoginPolicy == DuplicateLoginRejectNew {
+		l.mu.Unlock()
+		return errDuplicateLogin
+	}
+	previous := l.registry.add(c)
+	setCache(c)
+	l.mu.Unlock()
+	l.metrics.ConnOpened()
+
+	if previous != nil {
+		previous.log.Info("kicked in favour of a new login with the same XUID")
+		_ = l.DisconnectWithReason(previous, DisconnectReasonDuplicateLogin, "Logged in from another location")
+	}
+	return nil
+}
+
+// transportName returns a human-readable name of the transport passed, used in log messages.
+func transportName(transport tr.Transport) string {
+	switch transport.(type) {
+	case *tr.QUIC:
+		return "quic"
+	case *tr.Spectral:
+		return "spectral"
+	default:
+		return fmt.Sprintf("%T", transport)
+	}
+}
+
+// lookup converts the result of a registry lookup to a Conn, making sure that a nil *conn is never returned as
+// a non-nil interface.
+func lookup(c *conn, ok bool) (Conn, bool) {
+	if !ok {
+		return nil, false
+	}
+	return c, true
+}
+
+// listen accepts streams from the transport until it is closed, performing the handshake of each of them in
+// a separate goroutine so that a slow or misbehaving stream cannot hold up the others. No more than MaxHandshakes
+// streams are handshaking or waiting for Accept at the same time, so that the backpressure ends up in the queue
+// of the transport, both if proxies are slow and if the server is slow to accept connections.
+func (l *Listener) listen() {
+	for {
+		l.handshakes <- struct{}{}
+		rwc, info, err := l.transport.Accept()
+		if err != nil {
+			l.log.Debug("stopped accepting streams", "err", err)
+			return
+		}
+
+		// The transport stays open during a graceful shutdown, but new streams are refused before spending
+		// any time on their handshake.
+		select {
+		case <-l.closed:
+			<-l.handshakes
+			l.log.Debug("refused stream: listener is shutting down", "proxy", info.RemoteAddr)
+			_ = rwc.Close()
+			continue
+		default:
+		}
+		go l.handle(rwc, info)
+	}
+}
+
+// handle performs the handshake of a stream and hands the resulting connection over to Accept. Streams that
+// fail the handshake or do not complete it within the handshake timeout are closed and never reach Accept, as
+// returning an error from Accept would stop the server from accepting any further connections.
+func (l *Listener) handle(rwc io.ReadWriteCloser, info tr.StreamInfo) {
+	// The handshake slot is held until the connection is handed over to Accept, so that connections piling up
+	// because the server does not call Accept hold up the transport as well.
+	defer func() {
+		<-l.handshakes
+	}()
+	l.handler.HandleStreamAccept(info)
+	// Closing the stream unblocks the handshake if the proxy stops sending, regardless of whether the stream
+	// supports read deadlines.
+	timer := time.AfterFunc(l.handshakeTimeout, func() {
+		_ = rwc.Close()
+	})
+	c, err := newConn(rwc, info, l)
+	if !timer.Stop() {
+		if c != nil {
+			_ = c.Close()
+		}
+		err = errHandshakeTimeout
+	}
+	if errors.Is(err, errStatusOnly) {
+		l.log.Debug("closed status stream", "proxy", info.RemoteAddr, "err", err)
+		return
+	} else if errors.Is(err, errStatusUpdates) {
+		// Status streams stay open for as long as the proxy is connected, so they release their handshake slot
+		// right away.
+		c.log = c.log.With("proxy", info.RemoteAddr)
+		go l.subscribeStatus(c)
+		return
+	} else if err != nil {
+		l.log.Warn("handshake failed", "proxy", info.RemoteAddr, "err", err)
+		l.metrics.HandshakeFailed()
+		l.handler.HandleHandshakeFail(info, err)
+		return
+	}
+	l.metrics.HandshakeAccepted()
+	c.established.Store(true)
+	l.handler.HandleHandshake(c)
+	if l.capture != nil {
+		wc, err := l.capture(c)
+		if err == nil {
+			err = c.recorder.start(wc)
+		}
+		if err != nil {
+			c.log.Error("failed to start capture", "err", err)
+			c.recorder.stop()
+		}
+	}
+
+	if err := l.add(c); errors.Is(err, errDuplicateLogin) {
+		c.log.Info("rejected duplicate login")
+		_ = l.DisconnectWithReason(c, DisconnectReasonDuplicateLogin, "You are already logged in")
+		return
+	} else if err != nil {
+		// The Listener was shut down while the handshake was performed, so the connection is shut down like
+		// the connections that were already online, allowing the proxy to reroute the player.
+		l.shutdownConn(c)
+		_ = c.Close()
+		return
+	}
+
+	select {
+	case <-l.closed:
+		l.shutdownConn(c)
+		_ = c.Close()
+	case l.incoming <- c:
+	}
+}
@@ -0,0 +1,153 @@
+package spectrum
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/service"
+)
+
+// LoginVerification specifies how a Listener verifies the identity of the players sent to it by the proxy.
+//
+// Login requests are verified, but not bound to the stream they are sent on: the Listener cannot tell a login
+// request sent for a new connection from one the proxy sent before. A proxy holding the login request of a
+// player may therefore send it again, and join as that player, until the request expires. Verification only
+// prevents a proxy from sending players with an identity or client data they did not log in with.
+type LoginVerification uint8
+
+const (
+	// LoginVerificationNone trusts the IdentityData sent by the proxy in the ConnectionRequest.
+	LoginVerificationNone LoginVerification = iota
+	// LoginVerificationXBL requires the proxy to send the login request of every player, and verifies that it
+	// was authenticated by Xbox Live and belongs to the player the proxy claims it to be. The IdentityData of
+	// the connection is then taken from the verified login request, as is the ClientData, which is verified
+	// against the key of the player held by the request. As login requests expire, players staying
+	// on the proxy for longer than their login request is valid for can no longer be sent to the Listener.
+	LoginVerificationXBL
+	// LoginVerificationProxyKey requires the proxy to send the login request of every player signed with its own
+	// private key, such as one created using login.EncodeOffline with legacy set to false, and verifies it
+	// against ListenConfig.ProxyKey. Unlike LoginVerificationXBL, it also allows players that are not
+	// authenticated by Xbox Live, while a proxy that does not hold the private key still cannot change the
+	// identity or client data of a player. Requests created using login.EncodeOffline remain valid for six
+	// hours, during which they may be replayed by anyone holding them.
+	LoginVerificationProxyKey
+)
+
+// loginVerifier verifies a login request, returning the IdentityData and ClientData it holds.
+type loginVerifier func(request []byte) (login.IdentityData, login.ClientData, error)
+
+// newLoginVerifier returns the loginVerifier for the LoginVerification passed, or nil if login requests are not
+// verified. The proxy key passed is only used by LoginVerificationProxyKey.
+func newLoginVerifier(verification LoginVerification, proxyKey *ecdsa.PublicKey) (loginVerifier, error) {
+	switch verification {
+	case LoginVerificationNone:
+		return nil, nil
+	case LoginVerificationXBL:
+	case LoginVerificationProxyKey:
+		return newProxyKeyVerifier(proxyKey)
+	default:
+		return nil, fmt.Errorf("unknown login verification %v", verification)
+	}
+
+	// The token verifier is obtained the same way gophertunnel obtains it for its own listeners.
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	discovery, err := service.Discover(ctx, service.ApplicationTypeMinecraftPE, protocol.CurrentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("discover service endpoints: %w", err)
+	}
+
+	env := new(service.AuthorizationEnvironment)
+	if err := discovery.Environment(env); err != nil {
+		return nil, fmt.Errorf("decode environment for auth: %w", err)
+	}
+
+	verifier, err := env.VerifierContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OIDC verifier: %w", err)
+	}
+	return func(request []byte) (login.IdentityData, login.ClientData, error) {
+		identityData, clientData, result, err := login.Parse(request, verifier)
+		if err != nil {
+			return login.IdentityData{}, login.ClientData{}, err
+		}
+
+		if !result.XBOXLiveAuthenticated {
+			return login.IdentityData{}, login.ClientData{}, errors.New("login request is not authenticated by Xbox Live")
+		}
+		return identityData, clientData, nil
+	}, nil
+}
+
+// newProxyKeyVerifier returns a loginVerifier accepting login requests of which the token is signed with the
+// private key of the public key passed.
+func newProxyKeyVerifier(proxyKey *ecdsa.PublicKey) (loginVerifier, error) {
+	if proxyKey == nil {
+		return nil, errors.New("login verification using the proxy key requires a proxy key")
+	}
+
+	// The token is not issued by an OpenID provider, so only its signature and expiry are verified.
+	verifier := oidc.NewVerifier("", &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{proxyKey}}, &oidc.Config{
+		SkipClientIDCheck:    true,
+		SkipIssuerCheck:      true,
+		SupportedSigningAlgs: []string{oidc.ES384},
+	})
+	return func(request []byte) (login.IdentityData, login.ClientData, error) {
+		// login.Parse falls back to the self-signed legacy chain if the request holds no token, so such requests
+		// must be rejected before they reach it. The client data is verified against the key held by the token.
+		if !hasToken(request) {
+			return login.IdentityData{}, login.ClientData{}, errors.New("login request does not hold a token signed by the proxy")
+		}
+		identityData, clientData, _, err := login.Parse(request, verifier)
+		return identityData, clientData, err
+	}, nil
+}
+
+// hasToken checks if the login request passed holds a token in its chain data.
+func hasToken(request []byte) bool {
+	if len(request) < 4 {
+		return false
+	}
+
+	length := binary.LittleEndian.Uint32(request)
+	if uint64(length) > uint64(len(request)-4) {
+		return false
+	}
+
+	var chain struct {
+		Token string `json:"Token"`
+	}
+	return json.Unmarshal(request[4:4+length], &chain) == nil && chain.Token != ""
+}
+
+// verifyLogin verifies the login request sent by the proxy, if the Listener is configured to, and replaces the
+// IdentityData and ClientData of the connection with the verified ones.
+func (c *conn) verifyLogin(request []byte) error {
+	if c.listener.verifyLogin == nil {
+		return nil
+	}
+
+	if request == nil {
+		return errors.New("login verification failed: proxy did not send a login request")
+	}
+
+	identityData, clientData, err := c.listener.verifyLogin(request)
+	if err != nil {
+		return fmt.Errorf("login verification failed: %w", err)
+	}
+
+	if identityData.XUID != c.identityData.XUID {
+		return fmt.Errorf("login verification failed: proxy sent XUID %v, but login request belongs to %v", c.identityData.XUID, identityData.XUID)
+	}
+	c.identityData, c.clientData = identityData, clientData
+	return nil
+}
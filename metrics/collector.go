@@ -0,0 +1,45 @@
+package metrics
+
+import "time"
+
+// Collector receives the measurements taken by a Listener and the connections it accepts. Implementations must
+// be safe for concurrent use, as they are called from the goroutines of every connection.
+type Collector interface {
+	// HandshakeAccepted is called when a stream completes its handshake.
+	HandshakeAccepted()
+	// HandshakeFailed is called when a stream fails to complete its handshake.
+	HandshakeFailed()
+	// ConnOpened is called when a connection is handed over to the server.
+	ConnOpened()
+	// ConnClosed is called when a connection that was handed over to the server is closed.
+	ConnClosed()
+	// PacketRead is called for every packet read from the proxy, with the size of the frame before and after
+	// decompression.
+	PacketRead(id uint32, compressed, decompressed int)
+	// PacketWritten is called for every packet written to the proxy, with the size of the frame before and after
+	// compression and whether the proxy was asked to decode it.
+	PacketWritten(id uint32, compressed, decompressed int, decode bool)
+	// Latency is called every time the latency of a connection is updated.
+	Latency(latency time.Duration)
+	// StreamDropped is called when the transport closes an accepted stream because its incoming queue is full.
+	StreamDropped()
+	// ConnectionRejected is called when the transport rejects a connection from an address that is not allowed
+	// by its Filter.
+	ConnectionRejected()
+}
+
+// NopCollector is a Collector that discards all measurements.
+type NopCollector struct{}
+
+// Compile time check to make sure NopCollector implements Collector.
+var _ Collector = NopCollector{}
+
+func (NopCollector) HandshakeAccepted()                   {}
+func (NopCollector) HandshakeFailed()                     {}
+func (NopCollector) ConnOpened()                          {}
+func (NopCollector) ConnClosed()                          {}
+func (NopCollector) PacketRead(uint32, int, int)          {}
+func (NopCollector) PacketWritten(uint32, int, int, bool) {}
+func (NopCollector) Latency(time.Duration)                {}
+func (NopCollector) StreamDropped()                       {}
+func (NopCollector) ConnectionRejected()                  {}
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the buckets of the latency histogram.
+var latencyBuckets = [...]time.Duration{
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 2,
+}
+
+// Metrics is a Collector that keeps all measurements in memory and exposes them in the OpenMetrics text format,
+// either through WriteTo or by serving them over HTTP.
+type Metrics struct {
+	handshakesAccepted atomic.Uint64
+	handshakesFailed   atomic.Uint64
+	conns              atomic.Int64
+
+	streamsDropped      atomic.Uint64
+	connectionsRejected atomic.Uint64
+
+	read    direction
+	written direction
+
+	decodeNeeded    atomic.Uint64
+	decodeNotNeeded atomic.Uint64
+
+	latencyBuckets [len(latencyBuckets)]atomic.Uint64
+	latencyCount   atomic.Uint64
+	latencySum     atomic.Int64
+}
+
+// direction holds the per packet ID measurements for one direction of traffic.
+type direction struct {
+	mu      sync.RWMutex
+	packets map[uint32]*packetStats
+}
+
+// packetStats holds the measurements of a single packet ID in one direction.
+type packetStats struct {
+	count        atomic.Uint64
+	compressed   atomic.Uint64
+	decompressed atomic.Uint64
+}
+
+// New creates an empty Metrics.
+func New() *Metrics {
+	return &Metrics{
+		read:    direction{packets: make(map[uint32]*packetStats)},
+		written: direction{packets: make(map[uint32]*packetStats)},
+	}
+}
+
+// Compile time check to make sure Metrics implements Collector.
+var _ Collector = (*Metrics)(nil)
+
+// HandshakeAccepted ...
+func (m *Metrics) HandshakeAccepted() {
+	m.handshakesAccepted.Add(1)
+}
+
+// HandshakeFailed ...
+func (m *Metrics) HandshakeFailed() {
+	m.handshakesFailed.Add(1)
+}
+
+// ConnOpened ...
+func (m *Metrics) ConnOpened() {
+	m.conns.Add(1)
+}
+
+// ConnClosed ...
+func (m *Metrics) ConnClosed() {
+	m.conns.Add(-1)
+}
+
+// PacketRead ...
+func (m *Metrics) PacketRead(id uint32, compressed, decompressed int) {
+	m.read.add(id, compressed, decompressed)
+}
+
+// PacketWritten ...
+func (m *Metrics) PacketWritten(id uint32, compressed, decompressed int, decode bool) {
+	m.written.add(id, compressed, decompressed)
+	if decode {
+		m.decodeNeeded.Add(1)
+	} else {
+		m.decodeNotNeeded.Add(1)
+	}
+}
+
+// Latency ...
+func (m *Metrics) Latency(latency time.Duration) {
+	for i, bound := range latencyBuckets {
+		if latency <= bound {
+			m.latencyBuckets[i].Add(1)
+		}
+	}
+	m.latencyCount.Add(1)
+	m.latencySum.Add(int64(latency))
+}
+
+// StreamDropped ...
+func (m *Metrics) StreamDropped() {
+	m.streamsDropped.Add(1)
+}
+
+// ConnectionRejected ...
+func (m *Metrics) ConnectionRejected() {
+	m.connectionsRejected.Add(1)
+}
+
+// ServeHTTP serves the metrics in the OpenMetrics text format, so that a Metrics may be registered as the
+// handler of a scrape endpoint.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo writes the metrics to the writer passed in the OpenMetrics text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	cw.printf("# TYPE spectrum_handshakes counter\n")
+	cw.printf("# HELP spectrum_handshakes Handshakes performed with the proxy by result.\n")
+	cw.printf("spectrum_handshakes_total{result=\"accepted\"} %d\n", m.handshakesAccepted.Load())
+	cw.printf("spectrum_handshakes_total{result=\"failed\"} %d\n", m.handshakesFailed.Load())
+
+	cw.printf("# TYPE spectrum_connections gauge\n")
+	cw.printf("# HELP spectrum_connections Connections currently online.\n")
+	cw.printf("spectrum_connections %d\n", m.conns.Load())
+
+	cw.printf("# TYPE spectrum_streams_dropped counter\n")
+	cw.printf("# HELP spectrum_streams_dropped Streams closed by the transport because its incoming queue was full.\n")
+	cw.printf("spectrum_streams_dropped_total %d\n", m.streamsDropped.Load())
+
+	cw.printf("# TYPE spectrum_connections_rejected counter\n")
+	cw.printf("# HELP spectrum_connections_rejected Connections rejected by the filter of the transport.\n")
+	cw.printf("spectrum_connections_rejected_total %d\n", m.connectionsRejected.Load())
+
+	cw.printf("# TYPE spectrum_packets counter\n")
+	cw.printf("# HELP spectrum_packets Packets exchanged with the proxy by direction and packet ID.\n")
+	m.read.each(func(id uint32, stats *packetStats) {
+		cw.printf("spectrum_packets_total{direction=\"read\",id=\"%d\"} %d\n", id, stats.count.Load())
+	})
+	m.written.each(func(id uint32, stats *packetStats) {
+		cw.printf("spectrum_packets_total{direction=\"written\",id=\"%d\"} %d\n", id, stats.count.Load())
+	})
+
+	cw.printf("# TYPE spectrum_packet_bytes counter\n")
+	cw.printf("# UNIT spectrum_packet_bytes bytes\n")
+	cw.printf("# HELP spectrum_packet_bytes Bytes exchanged with the proxy by direction, packet ID and encoding.\n")
+	m.read.each(func(id uint32, stats *packetStats) {
+		cw.printf("spectrum_packet_bytes_total{direction=\"read\",id=\"%d\",encoding=\"compressed\"} %d\n", id, stats.compressed.Load())
+		cw.printf("spectrum_packet_bytes_total{direction=\"read\",id=\"%d\",encoding=\"decompressed\"} %d\n", id, stats.decompressed.Load())
+	})
+	m.written.each(func(id uint32, stats *packetStats) {
+		cw.printf("spectrum_packet_bytes_total{direction=\"written\",id=\"%d\",encoding=\"compressed\"} %d\n", id, stats.compressed.Load())
+		cw.printf("spectrum_packet_bytes_total{direction=\"written\",id=\"%d\",encoding=\"decompressed\"} %d\n", id, stats.decompressed.Load())
+	})
+
+	cw.printf("# TYPE spectrum_compression_ratio gauge\n")
+	cw.printf("# HELP spectrum_compression_ratio Ratio of decompressed to compressed bytes by direction.\n")
+	cw.printf("spectrum_compression_ratio{direction=\"read\"} %s\n", formatFloat(m.read.ratio()))
+	cw.printf("spectrum_compression_ratio{direction=\"written\"} %s\n", formatFloat(m.written.ratio()))
+
+	cw.printf("# TYPE spectrum_written_packets_decode counter\n")
+	cw.printf("# HELP spectrum_written_packets_decode Packets written to the proxy by whether it was asked to decode them.\n")
+	cw.printf("spectrum_written_packets_decode_total{decode=\"true\"} %d\n", m.decodeNeeded.Load())
+	cw.printf("spectrum_written_packets_decode_total{decode=\"false\"} %d\n", m.decodeNotNeeded.Load())
+
+	cw.printf("# TYPE spectrum_latency_seconds histogram\n")
+	cw.printf("# UNIT spectrum_latency_seconds seconds\n")
+	cw.printf("# HELP spectrum_latency_seconds Latency of the connections as reported by the proxy.\n")
+	for i, bound := range latencyBuckets {
+		cw.printf("spectrum_latency_seconds_bucket{le=\"%s\"} %d\n", formatFloat(bound.Seconds()), m.latencyBuckets[i].Load())
+	}
+	count := m.latencyCount.Load()
+	cw.printf("spectrum_latency_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	cw.printf("spectrum_latency_seconds_sum %s\n", formatFloat(time.Duration(m.latencySum.Load()).Seconds()))
+	cw.printf("spectrum_latency_seconds_count %d\n", count)
+	cw.printf("# EOF\n")
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// add records a packet with the ID and sizes passed.
+func (d *direction) add(id uint32, compressed, decompressed int) {
+	d.mu.RLock()
+	stats, ok := d.packets[id]
+	d.mu.RUnlock()
+	if !ok {
+		d.mu.Lock()
+		if stats, ok = d.packets[id]; !ok {
+			stats = &packetStats{}
+			d.packets[id] = stats
+		}
+		d.mu.Unlock()
+	}
+	stats.count.Add(1)
+	stats.compressed.Add(uint64(compressed))
+	stats.decompressed.Add(uint64(decompressed))
+}
+
+// each calls f for every packet ID recorded, in ascending order.
+func (d *direction) each(f func(id uint32, stats *packetStats)) {
+	d.mu.RLock()
+	ids := make([]uint32, 0, len(d.packets))
+	for id := range d.packets {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	stats := make([]*packetStats, len(ids))
+	for i, id := range ids {
+		stats[i] = d.packets[id]
+	}
+	d.mu.RUnlock()
+	for i, id := range ids {
+		f(id, stats[i])
+	}
+}
+
+// ratio returns the ratio of decompressed to compressed bytes over all packets, or 0 if nothing was recorded.
+func (d *direction) ratio() float64 {
+	var compressed, decompressed uint64
+	d.each(func(_ uint32, stats *packetStats) {
+		compressed += stats.compressed.Load()
+		decompressed += stats.decompressed.Load()
+	})
+	if compressed == 0 {
+		return 0
+	}
+	return float64(decompressed) / float64(compressed)
+}
+
+// countingWriter writes formatted lines to a buffered writer, keeping track of the bytes written and the first
+// error encountered.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...any) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -2,6 +2,7 @@ package spectrum
 
 import (
 	"github.com/brentp/intintmap"
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
 	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 )
@@ -13,6 +14,14 @@ var internalPackets = []uint32{
 	spectrumpacket.IDTransfer,
 	spectrumpacket.IDUpdateCache,
 
+	dfpacket.IDAuthChallenge,
+	dfpacket.IDDatagramResponse,
+	dfpacket.IDDisconnect,
+	dfpacket.IDResourcePacks,
+	dfpacket.IDStatus,
+	dfpacket.IDStreamHeader,
+	dfpacket.IDStreamResponse,
+
 	packet.IDAddActor,
 	packet.IDAddItemActor,
 	packet.IDAddPainting,
@@ -31,6 +40,7 @@ var internalPackets = []uint32{
 
 	packet.IDRemoveActor,
 	packet.IDRemoveObjective,
+	packet.IDResourcePackChunkData,
 
 	packet.IDSetDisplayObjective,
 	packet.IDStartGame,
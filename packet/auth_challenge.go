@@ -0,0 +1,20 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// AuthChallenge is sent by the server in response to the AuthRequest of the proxy when the listener has a shared
+// secret configured. The proxy must answer it with an AuthResponse before sending its ConnectionRequest.
+type AuthChallenge struct {
+	// Nonce is a random value that must be signed by the proxy using the shared secret.
+	Nonce []byte
+}
+
+// ID ...
+func (pk *AuthChallenge) ID() uint32 {
+	return IDAuthChallenge
+}
+
+// Marshal ...
+func (pk *AuthChallenge) Marshal(io protocol.IO) {
+	io.ByteSlice(&pk.Nonce)
+}
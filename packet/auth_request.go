@@ -0,0 +1,16 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// AuthRequest is sent by the proxy as the very first packet of a stream when the listener has a shared secret
+// configured, and is answered with an AuthChallenge. The proxy speaks first so that the stream is created on
+// transports such as Spectral, which only create a stream once the side that opened it has sent data over it.
+type AuthRequest struct{}
+
+// ID ...
+func (pk *AuthRequest) ID() uint32 {
+	return IDAuthRequest
+}
+
+// Marshal ...
+func (pk *AuthRequest) Marshal(protocol.IO) {}
@@ -0,0 +1,32 @@
+package packet
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+)
+
+// AuthResponse is sent by the proxy in response to an AuthChallenge. It proves that the proxy knows the shared
+// secret without ever sending it over the wire.
+type AuthResponse struct {
+	// MAC is the HMAC-SHA256 of the challenge nonce, keyed with the shared secret.
+	MAC []byte
+}
+
+// ID ...
+func (pk *AuthResponse) ID() uint32 {
+	return IDAuthResponse
+}
+
+// Marshal ...
+func (pk *AuthResponse) Marshal(io protocol.IO) {
+	io.ByteSlice(&pk.MAC)
+}
+
+// Sign computes the MAC expected in an AuthResponse for the nonce passed using the shared secret.
+func Sign(secret []byte, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,15 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// DatagramRequest is sent by the proxy right before its ConnectionRequest to signal that it supports receiving
+// packets of the player as unreliable datagrams. The server always answers it with a DatagramResponse.
+type DatagramRequest struct{}
+
+// ID ...
+func (pk *DatagramRequest) ID() uint32 {
+	return IDDatagramRequest
+}
+
+// Marshal ...
+func (pk *DatagramRequest) Marshal(protocol.IO) {}
@@ -0,0 +1,22 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// DatagramResponse is sent by the server in response to a DatagramRequest, right before its ConnectionResponse.
+// Every datagram sent for the player starts with the big-endian uint32 datagram ID it holds, followed by a frame
+// encoded the same way as frames sent over the stream.
+type DatagramResponse struct {
+	// DatagramID identifies the player in the datagrams sent by the server. It is 0 if the server does not send
+	// datagrams for the player, in which case all packets are sent over the stream.
+	DatagramID uint32
+}
+
+// ID ...
+func (pk *DatagramResponse) ID() uint32 {
+	return IDDatagramResponse
+}
+
+// Marshal ...
+func (pk *DatagramResponse) Marshal(io protocol.IO) {
+	io.Uint32(&pk.DatagramID)
+}
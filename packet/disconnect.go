@@ -0,0 +1,41 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+const (
+	// DisconnectReasonUnspecified is used when the server disconnects a player without a more specific reason,
+	// for example when a plugin kicks the player through the session directly.
+	DisconnectReasonUnspecified = iota
+	// DisconnectReasonKicked means the player was deliberately removed from the server and should not be sent
+	// to another server.
+	DisconnectReasonKicked
+	// DisconnectReasonServerFull means the server cannot accept the player right now. The proxy may route the
+	// player to another server.
+	DisconnectReasonServerFull
+	// DisconnectReasonShuttingDown means the server is shutting down. The proxy should route the player to
+	// another server.
+	DisconnectReasonShuttingDown
+	// DisconnectReasonDuplicateLogin means the player logged in from another location.
+	DisconnectReasonDuplicateLogin
+)
+
+// Disconnect is sent by the server right before the Minecraft Disconnect packet of a player, if the proxy sent a
+// DisconnectReasonRequest during the handshake. It carries a machine-readable reason that the proxy may use to
+// decide between kicking the player and falling back to another server, alongside the human-readable message.
+type Disconnect struct {
+	// Reason is one of the constants above.
+	Reason uint8
+	// Message is the message shown to the player if the proxy decides to disconnect them.
+	Message string
+}
+
+// ID ...
+func (pk *Disconnect) ID() uint32 {
+	return IDDisconnect
+}
+
+// Marshal ...
+func (pk *Disconnect) Marshal(io protocol.IO) {
+	io.Uint8(&pk.Reason)
+	io.String(&pk.Message)
+}
@@ -0,0 +1,16 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// DisconnectReasonRequest is sent by the proxy right before its ConnectionRequest to signal that it supports
+// receiving a Disconnect packet ahead of the Minecraft Disconnect packet of the player. Proxies that do not send
+// it are never sent a Disconnect packet.
+type DisconnectReasonRequest struct{}
+
+// ID ...
+func (pk *DisconnectReasonRequest) ID() uint32 {
+	return IDDisconnectReasonRequest
+}
+
+// Marshal ...
+func (pk *DisconnectReasonRequest) Marshal(protocol.IO) {}
@@ -0,0 +1,22 @@
+package packet
+
+// The IDs of the packets exchanged between the proxy and spectrum-df on top of the packets defined by Spectrum.
+// They are allocated from the upper end of the 10-bit packet ID space so that they never collide with Minecraft
+// or Spectrum packets.
+const (
+	IDAuthChallenge uint32 = iota + 0x3E0
+	IDAuthResponse
+	IDDisconnect
+	IDStreamRequest
+	IDStreamResponse
+	IDStreamHeader
+	IDDatagramRequest
+	IDDatagramResponse
+	IDResourcePacksRequest
+	IDResourcePacks
+	IDLoginRequest
+	IDStatusRequest
+	IDStatus
+	IDDisconnectReasonRequest
+	IDAuthRequest
+)
@@ -0,0 +1,22 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// LoginRequest is sent by the proxy right before its ConnectionRequest. It carries the login request the player
+// sent to the proxy, allowing the server to verify the identity of the player itself rather than trusting the
+// IdentityData in the ConnectionRequest.
+type LoginRequest struct {
+	// Request is the ConnectionRequest field of the Login packet sent by the player, holding the signed chain
+	// and client data of the player, or a login request holding the same data signed by the proxy itself.
+	Request []byte
+}
+
+// ID ...
+func (pk *LoginRequest) ID() uint32 {
+	return IDLoginRequest
+}
+
+// Marshal ...
+func (pk *LoginRequest) Marshal(io protocol.IO) {
+	io.ByteSlice(&pk.Request)
+}
@@ -0,0 +1,34 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+
+// NewClientPool returns a packet.Pool holding the packets sent by Minecraft clients along with the packets
+// added by spectrum-df that are sent by the proxy. The packets are not registered in the pools of gophertunnel
+// itself, so that other listeners in the same process, such as the one of Dragonfly, are left unaffected.
+func NewClientPool() packet.Pool {
+	pool := packet.NewClientPool()
+	pool[IDAuthRequest] = func() packet.Packet { return &AuthRequest{} }
+	pool[IDAuthResponse] = func() packet.Packet { return &AuthResponse{} }
+	pool[IDStreamRequest] = func() packet.Packet { return &StreamRequest{} }
+	pool[IDDatagramRequest] = func() packet.Packet { return &DatagramRequest{} }
+	pool[IDResourcePacksRequest] = func() packet.Packet { return &ResourcePacksRequest{} }
+	pool[IDLoginRequest] = func() packet.Packet { return &LoginRequest{} }
+	pool[IDStatusRequest] = func() packet.Packet { return &StatusRequest{} }
+	pool[IDDisconnectReasonRequest] = func() packet.Packet { return &DisconnectReasonRequest{} }
+	return pool
+}
+
+// NewServerPool returns a packet.Pool holding the packets sent by Minecraft servers along with the packets
+// added by spectrum-df that are sent by the server to the proxy. Like NewClientPool, it leaves the pools of
+// gophertunnel itself unaffected.
+func NewServerPool() packet.Pool {
+	pool := packet.NewServerPool()
+	pool[IDAuthChallenge] = func() packet.Packet { return &AuthChallenge{} }
+	pool[IDDisconnect] = func() packet.Packet { return &Disconnect{} }
+	pool[IDStreamResponse] = func() packet.Packet { return &StreamResponse{} }
+	pool[IDStreamHeader] = func() packet.Packet { return &StreamHeader{} }
+	pool[IDDatagramResponse] = func() packet.Packet { return &DatagramResponse{} }
+	pool[IDResourcePacks] = func() packet.Packet { return &ResourcePacks{} }
+	pool[IDStatus] = func() packet.Packet { return &Status{} }
+	return pool
+}
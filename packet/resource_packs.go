@@ -0,0 +1,33 @@
+package packet
+
+import (
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// ResourcePacks is sent by the server in response to a ResourcePacksRequest, right before its ConnectionResponse.
+// It advertises the resource packs of the server, so that the proxy can offer them to players during their
+// resource pack negotiation. The proxy downloads the content of the packs by sending ResourcePackChunkRequest
+// packets over the stream of any player, which the server answers with ResourcePackChunkData packets.
+type ResourcePacks struct {
+	// TexturePacksRequired specifies if players must download the resource packs in order to join.
+	TexturePacksRequired bool
+	// TexturePacks holds the information of the resource packs, as sent to the client in a ResourcePacksInfo
+	// packet.
+	TexturePacks []protocol.TexturePackInfo
+	// DataInfo holds the ResourcePackDataInfo of every resource pack in TexturePacks, in the same order, as sent
+	// to the client when it requests to download the pack.
+	DataInfo []packet.ResourcePackDataInfo
+}
+
+// ID ...
+func (pk *ResourcePacks) ID() uint32 {
+	return IDResourcePacks
+}
+
+// Marshal ...
+func (pk *ResourcePacks) Marshal(io protocol.IO) {
+	io.Bool(&pk.TexturePacksRequired)
+	protocol.Slice(io, &pk.TexturePacks)
+	protocol.Slice(io, &pk.DataInfo)
+}
@@ -0,0 +1,15 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// ResourcePacksRequest is sent by the proxy right before its ConnectionRequest to request the resource packs of
+// the server. The server always answers it with a ResourcePacks packet.
+type ResourcePacksRequest struct{}
+
+// ID ...
+func (pk *ResourcePacksRequest) ID() uint32 {
+	return IDResourcePacksRequest
+}
+
+// Marshal ...
+func (pk *ResourcePacksRequest) Marshal(protocol.IO) {}
@@ -0,0 +1,32 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// Status is sent by the server in response to a StatusRequest, and periodically if the proxy requested updates.
+// It holds the load of the server at the time it was sent.
+type Status struct {
+	// PlayerCount is the number of players currently online.
+	PlayerCount int32
+	// MaxPlayerCount is the maximum number of players that may be online at the same time. It is 0 if the
+	// server has no limit.
+	MaxPlayerCount int32
+	// TickTime is the time in microseconds the server recently took to process a single tick. It is 0 if the
+	// server does not report it.
+	TickTime int64
+	// Accepting specifies if the server accepts new players. It is unset once the server starts shutting down,
+	// or if the server asks for no new players to be sent to it.
+	Accepting bool
+}
+
+// ID ...
+func (pk *Status) ID() uint32 {
+	return IDStatus
+}
+
+// Marshal ...
+func (pk *Status) Marshal(io protocol.IO) {
+	io.Varint32(&pk.PlayerCount)
+	io.Varint32(&pk.MaxPlayerCount)
+	io.Varint64(&pk.TickTime)
+	io.Bool(&pk.Accepting)
+}
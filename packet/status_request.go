@@ -0,0 +1,25 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// StatusRequest is sent by the proxy to request the load of the server, so that it can route new players to the
+// least loaded server. It may be sent at any time, including right before the ConnectionRequest, and is always
+// answered with a Status packet right away. A proxy that only needs the status may close the stream once the
+// Status is read instead of sending a ConnectionRequest, which the server does not treat as a failed handshake.
+type StatusRequest struct {
+	// Updates specifies if the server should also send a Status packet over the stream periodically. It is only
+	// honoured if sent before the ConnectionRequest, in which case the stream is dedicated to status updates
+	// until it is closed and no ConnectionRequest may follow. Proxies therefore open a separate stream for the
+	// updates, regardless of whether any players are connected through them.
+	Updates bool
+}
+
+// ID ...
+func (pk *StatusRequest) ID() uint32 {
+	return IDStatusRequest
+}
+
+// Marshal ...
+func (pk *StatusRequest) Marshal(io protocol.IO) {
+	io.Bool(&pk.Updates)
+}
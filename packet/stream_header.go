@@ -0,0 +1,23 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// StreamHeader is the first packet sent by the server on every additional stream it opens to the proxy. The
+// proxy uses it to associate the stream with the player the StreamResponse with the same token was sent for.
+type StreamHeader struct {
+	// Token is the token of the StreamResponse sent on the original stream of the player.
+	Token []byte
+	// Priority is the priority of the packets sent over the stream.
+	Priority uint8
+}
+
+// ID ...
+func (pk *StreamHeader) ID() uint32 {
+	return IDStreamHeader
+}
+
+// Marshal ...
+func (pk *StreamHeader) Marshal(io protocol.IO) {
+	io.ByteSlice(&pk.Token)
+	io.Uint8(&pk.Priority)
+}
@@ -0,0 +1,15 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// StreamRequest is sent by the proxy right before its ConnectionRequest to signal that it supports receiving the
+// packets of the player over additional streams. The server always answers it with a StreamResponse.
+type StreamRequest struct{}
+
+// ID ...
+func (pk *StreamRequest) ID() uint32 {
+	return IDStreamRequest
+}
+
+// Marshal ...
+func (pk *StreamRequest) Marshal(protocol.IO) {}
@@ -0,0 +1,24 @@
+package packet
+
+import "github.com/sandertv/gophertunnel/minecraft/protocol"
+
+// StreamResponse is sent by the server in response to a StreamRequest, right before its ConnectionResponse. For
+// every priority it holds, the server opens an additional stream that starts with a StreamHeader carrying the
+// same token. If it holds no priorities, all packets of the player are sent over the original stream.
+type StreamResponse struct {
+	// Token is a random value identifying the player on the additional streams.
+	Token []byte
+	// Priorities holds the priorities of the packets sent over the additional streams, one per stream.
+	Priorities []uint8
+}
+
+// ID ...
+func (pk *StreamResponse) ID() uint32 {
+	return IDStreamResponse
+}
+
+// Marshal ...
+func (pk *StreamResponse) Marshal(io protocol.IO) {
+	io.ByteSlice(&pk.Token)
+	io.ByteSlice(&pk.Priorities)
+}
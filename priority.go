@@ -0,0 +1,50 @@
+package spectrum
+
+import (
+	"maps"
+
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+)
+
+// Priority is the class of a packet written to the proxy. Queued packets of a higher priority are written
+// before queued packets of a lower priority, so that latency sensitive packets are not held up behind bulk world
+// data. Packets of the same priority are always written in the order they were written in.
+type Priority uint8
+
+const (
+	// PriorityHigh is the priority of packets that should reach the player as soon as possible, such as
+	// movement and combat.
+	PriorityHigh Priority = iota
+	// PriorityNormal is the priority of packets without a configured priority.
+	PriorityNormal
+	// PriorityLow is the priority of bulk packets, such as chunks.
+	PriorityLow
+
+	priorityCount
+)
+
+// DefaultPriorities returns the priorities used by a Listener if ListenConfig.Priorities is left nil. Only the
+// latency packets of the proxy, which no other packet depends on, are of PriorityHigh, so that the defaults never
+// write a packet ahead of a packet it depends on. As a consequence, the defaults do not keep chunks from holding
+// up movement: this requires explicit configuration, as described in ListenConfig.Priorities.
+//
+// Changing the priority of a packet may reorder it relative to packets of other priorities written before it.
+// Giving entity movement a higher priority than AddActor, AddPlayer and RemoveActor, for example, may write the
+// movement of an entity before it is spawned or after it is removed, and giving MovePlayer a higher priority than
+// ChangeDimension may move a player in the dimension it is leaving. Packets that depend on each other should
+// therefore always share the same priority.
+func DefaultPriorities() map[uint32]Priority {
+	return maps.Clone(defaultPriorities)
+}
+
+var defaultPriorities = map[uint32]Priority{
+	spectrumpacket.IDLatency: PriorityHigh,
+}
+
+// priority returns the priority of the packet ID passed.
+func (l *Listener) priority(id uint32) Priority {
+	if priority, ok := l.priorities[id]; ok && priority < priorityCount {
+		return priority
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,122 @@
+package spectrum
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cooldogedev/spectrum-df/capture"
+	"github.com/df-mc/dragonfly/server/session"
+)
+
+// CaptureFunc returns the writer that the frames of a connection are captured to. It is called once the
+// connection completes its handshake. If it returns a nil writer, the connection is not captured.
+type CaptureFunc func(conn session.Conn) (io.WriteCloser, error)
+
+// CaptureToDir returns a CaptureFunc that captures every connection to a file in the directory passed, named
+// after the XUID of the player and the time the capture was started.
+func CaptureToDir(dir string) CaptureFunc {
+	return func(conn session.Conn) (io.WriteCloser, error) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s-%d.spcap", conn.IdentityData().XUID, time.Now().UnixNano())
+		return os.Create(filepath.Join(dir, name))
+	}
+}
+
+// recorder captures the frames of a connection. Frames exchanged during the handshake are buffered until the
+// CaptureFunc decides whether the connection is captured, so that a capture always holds the full session and
+// can be replayed from the start.
+type recorder struct {
+	mu      sync.Mutex
+	pending []capture.Frame
+	w       *capture.Writer
+	closer  io.Closer
+	stopped bool
+}
+
+// record records a frame. The payload is copied, as callers reuse their buffers.
+func (r *recorder) record(direction capture.Direction, decode uint8, payload []byte) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+
+	frame := capture.Frame{Direction: direction, Time: time.Now(), Decode: decode, Payload: slices.Clone(payload)}
+	if r.w == nil {
+		r.pending = append(r.pending, frame)
+		return
+	}
+
+	if err := r.w.WriteFrame(frame); err != nil {
+		r.stopLocked()
+	}
+}
+
+// start starts writing frames to the writer passed, beginning with the frames buffered so far. If the writer is
+// nil, the recorder is stopped instead.
+func (r *recorder) start(wc io.WriteCloser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		if wc != nil {
+			return wc.Close()
+		}
+		return nil
+	}
+
+	if wc == nil {
+		r.stopLocked()
+		return nil
+	}
+
+	w, err := capture.NewWriter(wc)
+	if err != nil {
+		_ = wc.Close()
+		r.stopLocked()
+		return err
+	}
+
+	r.w, r.closer = w, wc
+	for _, frame := range r.pending {
+		if err := w.WriteFrame(frame); err != nil {
+			r.stopLocked()
+			return err
+		}
+	}
+	r.pending = nil
+	return nil
+}
+
+// stop stops the recorder, closing the writer it was writing to.
+func (r *recorder) stop() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked()
+}
+
+func (r *recorder) stopLocked() {
+	if r.stopped {
+		return
+	}
+
+	r.stopped = true
+	r.pending = nil
+	if r.closer != nil {
+		_ = r.closer.Close()
+	}
+}
@@ -0,0 +1,142 @@
+package spectrum
+
+import (
+	"sync"
+
+	"github.com/df-mc/dragonfly/server/player"
+	"github.com/google/uuid"
+)
+
+// listeners holds the Listeners that have not been closed yet, so that PlayerConn can look players up in all of
+// them.
+var listeners sync.Map
+
+// PlayerConn returns the Conn of the player passed if it joined through a Listener and is still connected.
+func PlayerConn(p *player.Player) (Conn, bool) {
+	var found *conn
+	listeners.Range(func(key, _ any) bool {
+		c, ok := key.(*Listener).registry.uuid(p.UUID())
+		if ok {
+			found = c
+		}
+		return !ok
+	})
+	if found == nil {
+		return nil, false
+	}
+	return found, true
+}
+
+// registry keeps track of the connections of a Listener that completed their handshake and have not been
+// closed yet, indexed by the identifiers they are most commonly looked up by.
+type registry struct {
+	mu          sync.RWMutex
+	conns       map[*conn]struct{}
+	byXUID      map[string]*conn
+	byUUID      map[uuid.UUID]*conn
+	byRuntimeID map[uint64]*conn
+	wg          sync.WaitGroup
+}
+
+func newRegistry() *registry {
+	return &registry{
+		conns:       make(map[*conn]struct{}),
+		byXUID:      make(map[string]*conn),
+		byUUID:      make(map[uuid.UUID]*conn),
+		byRuntimeID: make(map[uint64]*conn),
+	}
+}
+
+// add adds a connection to the registry. If another connection with the same XUID was registered, it is
+// replaced and returned so that the caller can close it. Connections without an XUID, such as those of players
+// joining through a proxy in offline mode, are not indexed by XUID and never replace one another.
+func (r *registry) add(c *conn) (previous *conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[c] = struct{}{}
+	if xuid := c.identityData.XUID; xuid != "" {
+		previous = r.byXUID[xuid]
+		r.byXUID[xuid] = c
+	}
+	if id, err := uuid.Parse(c.identityData.Identity); err == nil {
+		r.byUUID[id] = c
+	}
+	r.byRuntimeID[c.runtimeID] = c
+	r.wg.Add(1)
+	return previous
+}
+
+// remove removes a connection from the registry and reports whether it was registered. Indices that were taken
+// over by a newer connection are left untouched.
+func (r *registry) remove(c *conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[c]; !ok {
+		return false
+	}
+
+	delete(r.conns, c)
+	if r.byXUID[c.identityData.XUID] == c {
+		delete(r.byXUID, c.identityData.XUID)
+	}
+	if id, err := uuid.Parse(c.identityData.Identity); err == nil && r.byUUID[id] == c {
+		delete(r.byUUID, id)
+	}
+	if r.byRuntimeID[c.runtimeID] == c {
+		delete(r.byRuntimeID, c.runtimeID)
+	}
+	r.wg.Done()
+	return true
+}
+
+// xuid returns the connection with the XUID passed.
+func (r *registry) xuid(xuid string) (*conn, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.byXUID[xuid]
+	return c, ok
+}
+
+// uuid returns the connection with the UUID passed.
+func (r *registry) uuid(id uuid.UUID) (*conn, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.byUUID[id]
+	return c, ok
+}
+
+// runtimeID returns the connection with the runtime ID passed.
+func (r *registry) runtimeID(id uint64) (*conn, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.byRuntimeID[id]
+	return c, ok
+}
+
+// all returns all connections in the registry.
+func (r *registry) all() []*conn {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	conns := make([]*conn, 0, len(r.conns))
+	for c := range r.conns {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// len returns the number of connections in the registry.
+func (r *registry) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.conns)
+}
+
+// wait returns a channel that is closed once the registry is empty.
+func (r *registry) wait() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	return done
+}
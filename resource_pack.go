@@ -0,0 +1,96 @@
+package spectrum
+
+import (
+	"io"
+	"strings"
+
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"github.com/sandertv/gophertunnel/minecraft/resource"
+)
+
+// packChunkSize is the size of a single chunk of data from a resource pack, the same as used by gophertunnel.
+const packChunkSize = 1024 * 128
+
+// sendResourcePacks answers the ResourcePacksRequest of the proxy with the resource packs of the Listener.
+func (c *conn) sendResourcePacks() error {
+	pk := &dfpacket.ResourcePacks{TexturePacksRequired: c.listener.texturePacksRequired}
+	for _, pack := range c.listener.resourcePacks {
+		texturePack := protocol.TexturePackInfo{
+			UUID:        pack.UUID(),
+			Version:     pack.Version(),
+			Size:        uint64(pack.Len()),
+			HasScripts:  pack.HasScripts(),
+			DownloadURL: pack.DownloadURL(),
+		}
+		if pack.Encrypted() {
+			texturePack.ContentKey = pack.ContentKey()
+			texturePack.ContentIdentity = pack.Manifest().Header.UUID.String()
+		}
+
+		checksum := pack.Checksum()
+		pk.TexturePacks = append(pk.TexturePacks, texturePack)
+		pk.DataInfo = append(pk.DataInfo, packet.ResourcePackDataInfo{
+			UUID:          pack.UUID().String() + "_" + pack.Version(),
+			DataChunkSize: packChunkSize,
+			ChunkCount:    uint32(pack.DataChunkCount(packChunkSize)),
+			Size:          uint64(pack.Len()),
+			Hash:          checksum[:],
+			PackType:      packType(pack),
+		})
+	}
+	return c.WritePacket(pk)
+}
+
+// handleResourcePackChunkRequest answers a ResourcePackChunkRequest sent by the proxy with the chunk of the
+// resource pack requested. Requests for unknown packs or chunks are logged and ignored.
+func (c *conn) handleResourcePackChunkRequest(pk *packet.ResourcePackChunkRequest) error {
+	id, _, _ := strings.Cut(pk.UUID, "_")
+	var pack *resource.Pack
+	for _, p := range c.listener.resourcePacks {
+		if p.UUID().String() == id {
+			pack = p
+			break
+		}
+	}
+	if pack == nil {
+		c.log.Debug("resource pack chunk requested for unknown pack", "uuid", pk.UUID)
+		return nil
+	}
+
+	offset := uint64(pk.ChunkIndex) * packChunkSize
+	if pk.ChunkIndex < 0 || offset >= uint64(pack.Len()) {
+		c.log.Debug("resource pack chunk requested out of range", "uuid", pk.UUID, "chunk", pk.ChunkIndex)
+		return nil
+	}
+
+	response := &packet.ResourcePackChunkData{
+		UUID:       pk.UUID,
+		ChunkIndex: uint32(pk.ChunkIndex),
+		DataOffset: offset,
+		Data:       make([]byte, packChunkSize),
+	}
+	n, err := pack.ReadAt(response.Data, int64(offset))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	response.Data = response.Data[:n]
+	return c.WritePacket(response)
+}
+
+// packType returns the resource pack type of the pack passed, as determined by gophertunnel.
+func packType(pack *resource.Pack) byte {
+	switch {
+	case pack.HasWorldTemplate():
+		return packet.ResourcePackTypeWorldTemplate
+	case pack.HasTextures() && (pack.HasBehaviours() || pack.HasScripts()):
+		return packet.ResourcePackTypeAddon
+	case !pack.HasTextures() && (pack.HasBehaviours() || pack.HasScripts()):
+		return packet.ResourcePackTypeBehaviour
+	case pack.HasTextures():
+		return packet.ResourcePackTypeResources
+	default:
+		return packet.ResourcePackTypeSkins
+	}
+}
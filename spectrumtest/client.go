@@ -0,0 +1,348 @@
+package spectrumtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	spectrumprotocol "github.com/cooldogedev/spectrum/protocol"
+	spectrumpacket "github.com/cooldogedev/spectrum/server/packet"
+	"github.com/golang/snappy"
+	"github.com/google/uuid"
+	"github.com/sandertv/gophertunnel/minecraft/protocol"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// Config holds the settings used to dial a Listener as a fake proxy.
+type Config struct {
+	// Dialer is used to open the stream to the Listener. If left nil, a SpectralDialer is used.
+	Dialer Dialer
+	// Addr is the address of the player reported to the Listener in the ConnectionRequest. If left empty,
+	// 127.0.0.1:19132 is used.
+	Addr string
+	// ClientData is the client data sent in the ConnectionRequest. If left empty, DefaultClientData is used.
+	ClientData login.ClientData
+	// IdentityData is the identity data sent in the ConnectionRequest. If left empty, an identity with a random
+	// UUID is used.
+	IdentityData login.IdentityData
+	// Cache is the cache sent in the ConnectionRequest.
+	Cache []byte
+	// ProtocolID is the protocol ID sent in the ConnectionRequest. If left 0, protocol.CurrentProtocol is used.
+	ProtocolID int32
+	// Secret is the secret shared with the Listener, used to answer its authentication challenge.
+	Secret []byte
+	// LoginRequest, if non-nil, is sent to the Listener before the ConnectionRequest, for Listeners verifying the
+	// login requests of players.
+	LoginRequest []byte
+}
+
+// Client is a fake Spectrum proxy connected to a Listener on behalf of a single player. It allows tests to
+// drive a player through a Listener without running a proxy or a Minecraft client.
+type Client struct {
+	stream    io.ReadWriteCloser
+	reader    *spectrumprotocol.Reader
+	writer    *spectrumprotocol.Writer
+	pool      packet.Pool
+	runtimeID uint64
+	uniqueID  int64
+	shieldID  int32
+	mu        sync.Mutex
+}
+
+// Dial dials the Listener listening on the address passed using a default Config.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	return Config{}.Dial(ctx, addr)
+}
+
+// Dial dials the Listener listening on the address passed and performs the handshake, returning a Client once
+// the Listener has responded to the ConnectionRequest.
+func (cfg Config) Dial(ctx context.Context, addr string) (*Client, error) {
+	if cfg.Dialer == nil {
+		cfg.Dialer = SpectralDialer{}
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = "127.0.0.1:19132"
+	}
+	if cfg.ClientData.GameVersion == "" {
+		cfg.ClientData = DefaultClientData()
+	}
+	if cfg.IdentityData.Identity == "" {
+		cfg.IdentityData.Identity = uuid.New().String()
+	}
+	if cfg.IdentityData.DisplayName == "" {
+		cfg.IdentityData.DisplayName = "spectrumtest"
+	}
+	if cfg.ProtocolID == 0 {
+		cfg.ProtocolID = protocol.CurrentProtocol
+	}
+
+	stream, err := cfg.Dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newClient(stream)
+	if err := c.handshake(cfg); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Status dials the Listener listening on the address passed and requests its status. The stream is closed once
+// the Status is read, without sending a ConnectionRequest.
+func (cfg Config) Status(ctx context.Context, addr string) (*dfpacket.Status, error) {
+	c, err := cfg.requestStatus(ctx, addr, false)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	pk, err := c.Expect(dfpacket.IDStatus)
+	if err != nil {
+		return nil, err
+	}
+	return pk.(*dfpacket.Status), nil
+}
+
+// StatusUpdates dials the Listener listening on the address passed and subscribes to its status updates. The
+// Status packets sent by the Listener, starting with the one answering the request, are read from the Client
+// returned using Expect. Closing the Client ends the subscription.
+func (cfg Config) StatusUpdates(ctx context.Context, addr string) (*Client, error) {
+	return cfg.requestStatus(ctx, addr, true)
+}
+
+// requestStatus dials the Listener listening on the address passed and sends a StatusRequest on a new stream.
+func (cfg Config) requestStatus(ctx context.Context, addr string, updates bool) (*Client, error) {
+	if cfg.Dialer == nil {
+		cfg.Dialer = SpectralDialer{}
+	}
+
+	stream, err := cfg.Dialer.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newClient(stream)
+	if err := c.authenticate(cfg.Secret); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if err := c.WritePacket(&dfpacket.StatusRequest{Updates: updates}); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient returns a Client reading from and writing to the stream passed.
+func newClient(stream io.ReadWriteCloser) *Client {
+	return &Client{
+		stream: stream,
+		reader: spectrumprotocol.NewReader(stream),
+		writer: spectrumprotocol.NewWriter(stream),
+		pool:   dfpacket.NewServerPool(),
+	}
+}
+
+// RuntimeID returns the runtime ID assigned to the player by the Listener.
+func (c *Client) RuntimeID() uint64 {
+	return c.runtimeID
+}
+
+// UniqueID returns the unique ID assigned to the player by the Listener.
+func (c *Client) UniqueID() int64 {
+	return c.uniqueID
+}
+
+// StartGame drives the player through the StartGame sequence of the Listener, returning the StartGame packet
+// sent by it. It must be called once the server calls StartGameContext on the connection, which Dragonfly does
+// right after accepting it.
+func (c *Client) StartGame() (*packet.StartGame, error) {
+	pk, err := c.Expect(packet.IDStartGame)
+	if err != nil {
+		return nil, err
+	}
+	startGame := pk.(*packet.StartGame)
+
+	pk, err = c.Expect(packet.IDItemRegistry)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range pk.(*packet.ItemRegistry).Items {
+		if item.Name == "minecraft:shield" {
+			c.shieldID = int32(item.RuntimeID)
+			break
+		}
+	}
+
+	if err := c.WritePacket(&packet.RequestChunkRadius{ChunkRadius: 16, MaxChunkRadius: 16}); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.Expect(packet.IDPlayStatus); err != nil {
+		return nil, err
+	}
+
+	if err := c.WritePacket(&packet.SetLocalPlayerAsInitialised{EntityRuntimeID: startGame.EntityRuntimeID}); err != nil {
+		return nil, err
+	}
+	return startGame, nil
+}
+
+// ReadPacket reads the next packet sent by the Listener.
+func (c *Client) ReadPacket() (pk packet.Packet, err error) {
+	payload, err := c.reader.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) == 0 {
+		return nil, errors.New("empty frame")
+	}
+
+	decompressed, err := snappy.Decode(nil, payload[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(decompressed)
+	header := &packet.Header{}
+	if err := header.Read(buf); err != nil {
+		return nil, err
+	}
+
+	factory, ok := c.pool[header.PacketID]
+	if !ok {
+		return nil, fmt.Errorf("unknown packet ID %v", header.PacketID)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while decoding packet %v: %v", header.PacketID, r)
+		}
+	}()
+	pk = factory()
+	pk.Marshal(protocol.NewReader(buf, c.shieldID, false))
+	return pk, nil
+}
+
+// WritePacket writes a packet to the Listener as if it was sent by the player.
+func (c *Client) WritePacket(pk packet.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buf := bytes.NewBuffer(nil)
+	header := &packet.Header{PacketID: pk.ID()}
+	if err := header.Write(buf); err != nil {
+		return err
+	}
+	pk.Marshal(protocol.NewWriter(buf, c.shieldID))
+	return c.writer.Write(snappy.Encode(nil, buf.Bytes()))
+}
+
+// Expect reads packets until a packet with the ID passed is read, discarding any other packets.
+func (c *Client) Expect(id uint32) (packet.Packet, error) {
+	for {
+		pk, err := c.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		if pk.ID() == id {
+			return pk, nil
+		}
+	}
+}
+
+// Close closes the stream to the Listener, as the proxy does when the player disconnects.
+func (c *Client) Close() error {
+	return c.stream.Close()
+}
+
+// handshake authenticates with the Listener if a secret is set and sends the ConnectionRequest.
+func (c *Client) handshake(cfg Config) error {
+	if err := c.authenticate(cfg.Secret); err != nil {
+		return err
+	}
+
+	clientData, err := json.Marshal(cfg.ClientData)
+	if err != nil {
+		return err
+	}
+
+	identityData, err := json.Marshal(cfg.IdentityData)
+	if err != nil {
+		return err
+	}
+
+	if cfg.LoginRequest != nil {
+		if err := c.WritePacket(&dfpacket.LoginRequest{Request: cfg.LoginRequest}); err != nil {
+			return err
+		}
+	}
+
+	if err := c.WritePacket(&spectrumpacket.ConnectionRequest{
+		Addr:         cfg.Addr,
+		ClientData:   clientData,
+		IdentityData: identityData,
+		ProtocolID:   cfg.ProtocolID,
+		Cache:        cfg.Cache,
+	}); err != nil {
+		return err
+	}
+
+	pk, err := c.Expect(spectrumpacket.IDConnectionResponse)
+	if err != nil {
+		return err
+	}
+
+	response := pk.(*spectrumpacket.ConnectionResponse)
+	c.runtimeID, c.uniqueID = response.RuntimeID, response.UniqueID
+	return nil
+}
+
+// authenticate requests and answers the authentication challenge of the Listener if a secret is set.
+func (c *Client) authenticate(secret []byte) error {
+	if len(secret) == 0 {
+		return nil
+	}
+
+	if err := c.WritePacket(&dfpacket.AuthRequest{}); err != nil {
+		return err
+	}
+
+	pk, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+
+	challenge, ok := pk.(*dfpacket.AuthChallenge)
+	if !ok {
+		return fmt.Errorf("expected authentication challenge, got packet %v", pk.ID())
+	}
+	return c.WritePacket(&dfpacket.AuthResponse{MAC: dfpacket.Sign(secret, challenge.Nonce)})
+}
+
+// DefaultClientData returns client data with a blank 64x64 skin that is accepted by Dragonfly.
+func DefaultClientData() login.ClientData {
+	return login.ClientData{
+		GameVersion:       protocol.CurrentVersion,
+		LanguageCode:      "en_US",
+		DeviceOS:          protocol.DeviceWin10,
+		DeviceID:          login.DeviceID(uuid.New().String()),
+		SelfSignedID:      uuid.New().String(),
+		SkinID:            uuid.New().String(),
+		SkinImageWidth:    64,
+		SkinImageHeight:   64,
+		SkinData:          base64.StdEncoding.EncodeToString(make([]byte, 64*64*4)),
+		SkinResourcePatch: base64.StdEncoding.EncodeToString([]byte(`{"geometry":{"default":"geometry.humanoid.custom"}}`)),
+	}
+}
@@ -0,0 +1,205 @@
+package spectrumtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	spectrum "github.com/cooldogedev/spectrum-df"
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	"github.com/cooldogedev/spectrum-df/spectrumtest"
+	tr "github.com/cooldogedev/spectrum-df/transport"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+)
+
+// TestClient drives a player through the handshake and StartGame sequence of a Listener over the Spectral
+// transport, and exchanges a packet in both directions once the player has spawned.
+func TestClient(t *testing.T) {
+	secret := []byte("secret")
+	l, err := spectrum.ListenConfig{Secret: secret}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve(ctx, l)
+	}()
+
+	c, err := spectrumtest.Config{Secret: secret, IdentityData: login.IdentityData{XUID: "1234"}}.Dial(ctx, addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	startGame, err := c.StartGame()
+	if err != nil {
+		t.Fatalf("start game: %v", err)
+	}
+	if startGame.EntityRuntimeID != c.RuntimeID() || startGame.EntityUniqueID != c.UniqueID() {
+		t.Errorf("start game holds IDs %v/%v, want %v/%v", startGame.EntityRuntimeID, startGame.EntityUniqueID, c.RuntimeID(), c.UniqueID())
+	}
+
+	if err := c.WritePacket(&packet.Text{TextType: packet.TextTypeChat, Message: "ping"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	pk, err := c.Expect(packet.IDText)
+	if err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+	if msg := pk.(*packet.Text).Message; msg != "pong" {
+		t.Errorf("got message %q, want %q", msg, "pong")
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("listener: %v", err)
+	}
+}
+
+// TestClientSecret checks that a proxy that does not know the secret of a Listener is refused during the
+// handshake.
+func TestClientSecret(t *testing.T) {
+	l, err := spectrum.ListenConfig{Secret: []byte("secret")}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := spectrumtest.Config{Secret: []byte("wrong")}.Dial(ctx, l.Addr().String())
+	if err == nil {
+		_ = c.Close()
+		t.Fatal("dial with the wrong secret succeeded")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("dial with the wrong secret was not refused before the deadline: %v", err)
+	}
+}
+
+// TestStatus requests the status of a Listener over a stream that is closed once the Status is read, which must
+// not be reported as a failed handshake.
+func TestStatus(t *testing.T) {
+	handler := &failHandler{failed: make(chan error, 1)}
+	l, err := spectrum.ListenConfig{Handler: handler}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	status, err := spectrumtest.Config{}.Status(ctx, addr)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !status.Accepting {
+		t.Errorf("got status %+v, want accepting", status)
+	}
+
+	select {
+	case err := <-handler.failed:
+		t.Errorf("status stream reported as failed handshake: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// TestStatusUpdates subscribes to the status updates of a Listener and checks that they keep arriving for longer
+// than the handshake timeout, without taking up the only handshake slot of the Listener.
+func TestStatusUpdates(t *testing.T) {
+	handler := &failHandler{failed: make(chan error, 1)}
+	l, err := spectrum.ListenConfig{
+		Handler:          handler,
+		StatusInterval:   20 * time.Millisecond,
+		HandshakeTimeout: 200 * time.Millisecond,
+		MaxHandshakes:    1,
+	}.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	updates, err := spectrumtest.Config{}.StatusUpdates(ctx, addr)
+	if err != nil {
+		t.Fatalf("status updates: %v", err)
+	}
+	defer updates.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve(ctx, l)
+	}()
+	c, err := spectrumtest.Dial(ctx, addr)
+	if err != nil {
+		t.Fatalf("dial while subscribed to status updates: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.StartGame(); err != nil {
+		t.Fatalf("start game: %v", err)
+	}
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	var received int
+	for time.Now().Before(deadline) {
+		if _, err := updates.Expect(dfpacket.IDStatus); err != nil {
+			t.Fatalf("read status update %v: %v", received, err)
+		}
+		received++
+	}
+	if received < 5 {
+		t.Errorf("got %v status updates, want at least 5", received)
+	}
+
+	select {
+	case err := <-handler.failed:
+		t.Errorf("status stream reported as failed handshake: %v", err)
+	default:
+	}
+}
+
+// failHandler records the errors of failed handshakes.
+type failHandler struct {
+	spectrum.NopListenerHandler
+	failed chan error
+}
+
+// HandleHandshakeFail ...
+func (h *failHandler) HandleHandshakeFail(_ tr.StreamInfo, err error) {
+	h.failed <- err
+}
+
+// serve accepts a single connection from the Listener, starts the game for it and answers the first Text packet
+// it reads.
+func serve(ctx context.Context, l *spectrum.Listener) error {
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	if err := conn.StartGameContext(ctx, minecraft.GameData{}); err != nil {
+		return err
+	}
+
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			return err
+		}
+		if _, ok := pk.(*packet.Text); ok {
+			return conn.WritePacket(&packet.Text{TextType: packet.TextTypeRaw, Message: "pong"})
+		}
+	}
+}
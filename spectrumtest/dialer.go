@@ -0,0 +1,74 @@
+package spectrumtest
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+
+	"github.com/cooldogedev/spectral"
+	"github.com/quic-go/quic-go"
+)
+
+// Dialer opens a stream to a Listener, acting as the transport of a proxy.
+type Dialer interface {
+	// Dial opens a stream to the Listener listening on the address passed.
+	Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error)
+}
+
+// SpectralDialer dials Listeners using the Spectral transport.
+type SpectralDialer struct{}
+
+// Dial ...
+func (SpectralDialer) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	connection, err := spectral.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := connection.OpenStream(ctx)
+	if err != nil {
+		_ = connection.CloseWithError(0, "failed to open stream")
+		return nil, err
+	}
+	return &connStream{ReadWriteCloser: stream, closer: func() error { return connection.CloseWithError(0, "") }}, nil
+}
+
+// QUICDialer dials Listeners using the QUIC transport.
+type QUICDialer struct {
+	// TLSConfig is the TLS configuration used to dial. If left nil, a configuration that skips verifying the
+	// certificate of the Listener is used.
+	TLSConfig *tls.Config
+}
+
+// Dial ...
+func (d QUICDialer) Dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	tlsConfig := d.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"spectrum"}}
+	}
+
+	connection, err := quic.DialAddr(ctx, addr, tlsConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := connection.OpenStreamSync(ctx)
+	if err != nil {
+		_ = connection.CloseWithError(0, "failed to open stream")
+		return nil, err
+	}
+	return &connStream{ReadWriteCloser: stream, closer: func() error { return connection.CloseWithError(0, "") }}, nil
+}
+
+// connStream is a stream that closes the connection it was opened on when closed, as every Client opens a
+// connection of its own.
+type connStream struct {
+	io.ReadWriteCloser
+	closer func() error
+}
+
+// Close ...
+func (s *connStream) Close() error {
+	_ = s.ReadWriteCloser.Close()
+	return s.closer()
+}
@@ -0,0 +1,134 @@
+package spectrum
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+)
+
+// Status is the load of the server reported to the proxy, allowing it to route new players to the least loaded
+// server.
+type Status struct {
+	// PlayerCount is the number of players currently online.
+	PlayerCount int
+	// MaxPlayerCount is the maximum number of players that may be online at the same time, or 0 if there is no
+	// limit.
+	MaxPlayerCount int
+	// TickTime is the time the server recently took to process a single tick, or 0 if it is not reported.
+	TickTime time.Duration
+	// Accepting specifies if the server accepts new players.
+	Accepting bool
+}
+
+// StatusFunc is called every time the Status of a Listener is reported to the proxy. The Status passed holds the
+// number of players online and whether the Listener is still accepting connections, and may be changed to
+// report the remaining fields, such as the MaxPlayerCount of the server.Config, or to stop new players from being
+// sent to the server.
+type StatusFunc func(status *Status)
+
+// Status returns the Status of the Listener as reported to the proxy.
+func (l *Listener) Status() Status {
+	status := Status{PlayerCount: l.Count(), Accepting: true}
+	select {
+	case <-l.closed:
+		status.Accepting = false
+	default:
+	}
+
+	if l.status != nil {
+		l.status(&status)
+	}
+	return status
+}
+
+// statusPacket returns a Status packet holding the current Status of the Listener.
+func (l *Listener) statusPacket() *dfpacket.Status {
+	status := l.Status()
+	return &dfpacket.Status{
+		PlayerCount:    int32(status.PlayerCount),
+		MaxPlayerCount: int32(status.MaxPlayerCount),
+		TickTime:       status.TickTime.Microseconds(),
+		Accepting:      status.Accepting,
+	}
+}
+
+// reportStatus sends a Status packet to every stream subscribed to status updates, every status interval, until
+// the Listener is closed.
+func (l *Listener) reportStatus() {
+	ticker := time.NewTicker(l.statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.closed:
+			return
+		case <-ticker.C:
+			l.sendStatus()
+		}
+	}
+}
+
+// sendStatus sends a Status packet to every stream subscribed to status updates.
+func (l *Listener) sendStatus() {
+	l.statusMu.Lock()
+	streams := slices.Collect(maps.Keys(l.statusStreams))
+	l.statusMu.Unlock()
+	if len(streams) == 0 {
+		return
+	}
+
+	pk := l.statusPacket()
+	for _, c := range streams {
+		if err := c.WritePacket(pk); err != nil {
+			c.log.Debug("failed to send status", "err", err)
+		}
+	}
+}
+
+// subscribeStatus keeps a stream that requested status updates during its handshake open, sending it the Status
+// of the Listener every status interval until the proxy closes it or the Listener is closed. The stream no
+// longer counts as a handshake, so it is not subject to the handshake timeout and does not hold up other
+// streams.
+func (l *Listener) subscribeStatus(c *conn) {
+	c.startWriting()
+	l.statusMu.Lock()
+	l.statusStreams[c] = struct{}{}
+	l.statusMu.Unlock()
+	defer func() {
+		l.statusMu.Lock()
+		delete(l.statusStreams, c)
+		l.statusMu.Unlock()
+		_ = c.Close()
+	}()
+
+	for {
+		pk, err := c.read()
+		if err != nil {
+			c.log.Debug("closed status stream", "err", err)
+			return
+		}
+
+		if pk, ok := pk.(*dfpacket.StatusRequest); ok {
+			if err := c.handleStatusRequest(pk); err != nil {
+				c.log.Debug("failed to reply to status request", "err", err)
+			}
+		}
+	}
+}
+
+// closeStatusStreams closes every stream subscribed to status updates.
+func (l *Listener) closeStatusStreams() {
+	l.statusMu.Lock()
+	streams := slices.Collect(maps.Keys(l.statusStreams))
+	l.statusMu.Unlock()
+	for _, c := range streams {
+		_ = c.Close()
+	}
+}
+
+// handleStatusRequest answers a StatusRequest sent by the proxy with the Status of the Listener.
+func (c *conn) handleStatusRequest(*dfpacket.StatusRequest) error {
+	c.statusSent = true
+	return c.WritePacket(c.listener.statusPacket())
+}
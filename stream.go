@@ -0,0 +1,227 @@
+package spectrum
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"time"
+
+	dfpacket "github.com/cooldogedev/spectrum-df/packet"
+	tr "github.com/cooldogedev/spectrum-df/transport"
+	spectrumprotocol "github.com/cooldogedev/spectrum/protocol"
+)
+
+// stream is a stream to the proxy that frames are written to by a goroutine of its own, so that frames written
+// from different goroutines never interleave. Every connection has a main stream, the one accepted from the
+// transport, and optionally additional streams that the frames of a single priority are written to instead, so
+// that packet loss on one stream does not hold up the frames of the others.
+type stream struct {
+	conn   *conn
+	rwc    io.ReadWriteCloser
+	writer *spectrumprotocol.Writer
+	queues [priorityCount]chan *[]byte
+	err    error
+	done   chan struct{}
+}
+
+// newStream creates a stream writing to the io.ReadWriteCloser passed. Frames are only routed to it once route
+// is called.
+func newStream(c *conn, rwc io.ReadWriteCloser) *stream {
+	return &stream{
+		conn:   c,
+		rwc:    rwc,
+		writer: spectrumprotocol.NewWriter(rwc),
+		done:   make(chan struct{}),
+	}
+}
+
+// route routes the frames of the priority passed to the stream. It must only be called during the handshake.
+func (s *stream) route(priority Priority) {
+	s.queues[priority] = make(chan *[]byte, s.conn.listener.writeQueueSize)
+	s.conn.routes[priority] = s
+}
+
+// startWriting starts the goroutines writing the queued frames of the streams of the connection. Until it is
+// called at the end of the handshake, frames are written directly by the goroutine performing the handshake, so
+// that packets written once the connection is accepted can never be prioritised over the handshake.
+func (c *conn) startWriting() {
+	c.writing = true
+	for _, s := range c.streams {
+		go s.writeLoop()
+	}
+}
+
+// enqueue queues a frame to be written to the proxy by the stream that the priority passed is routed to. If the
+// queue stays full for longer than the write timeout, the proxy is considered unresponsive and the connection is
+// closed.
+func (c *conn) enqueue(frame *[]byte, priority Priority) error {
+	if !c.writing {
+		// The proxy reads the handshake from the main stream, whatever the priority of the packets it holds.
+		return c.streams[0].writeFrame(frame)
+	}
+
+	s := c.routes[priority]
+
+	queue := s.queues[priority]
+	select {
+	case <-c.closed:
+		putFrame(frame)
+		return errConnClosed
+	case <-s.done:
+		putFrame(frame)
+		return s.err
+	case queue <- frame:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(c.listener.writeTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.closed:
+		putFrame(frame)
+		return errConnClosed
+	case <-s.done:
+		putFrame(frame)
+		return s.err
+	case queue <- frame:
+		return nil
+	case <-timer.C:
+		putFrame(frame)
+		c.log.Warn("closing connection", "err", errWriteQueueFull)
+		c.setCloseReason(errWriteQueueFull)
+		_ = c.Close()
+		return errWriteQueueFull
+	}
+}
+
+// writeLoop writes the frames queued for the stream one at a time, highest priority first. Once the connection
+// is closed, the frames still queued, such as a Disconnect packet written right before closing, are written
+// before the loop returns.
+func (s *stream) writeLoop() {
+	defer close(s.done)
+	for {
+		frame, ok := s.nextFrame()
+		if !ok {
+			s.err = errConnClosed
+			return
+		}
+
+		if err := s.writeFrame(frame); err != nil {
+			s.err = err
+			return
+		}
+	}
+}
+
+// nextFrame returns the queued frame of the highest priority, waiting for a frame to be queued if there is none.
+// Once the connection is closed and all queues are drained, it returns false.
+func (s *stream) nextFrame() (*[]byte, bool) {
+	if frame, ok := s.pollFrame(); ok {
+		return frame, true
+	}
+
+	select {
+	case frame := <-s.queues[PriorityHigh]:
+		return frame, true
+	case frame := <-s.queues[PriorityNormal]:
+		return frame, true
+	case frame := <-s.queues[PriorityLow]:
+		return frame, true
+	case <-s.conn.closed:
+		return s.pollFrame()
+	}
+}
+
+// pollFrame returns the queued frame of the highest priority without waiting.
+func (s *stream) pollFrame() (*[]byte, bool) {
+	for _, queue := range s.queues {
+		select {
+		case frame := <-queue:
+			return frame, true
+		default:
+		}
+	}
+	return nil, false
+}
+
+// writeFrame writes a single frame, applying the write timeout if the stream supports deadlines. A failed write
+// leaves the stream in an unknown state, so the main stream is closed, which in turn ends the connection once
+// its reader notices.
+func (s *stream) writeFrame(frame *[]byte) error {
+	defer putFrame(frame)
+	if d, ok := s.rwc.(interface{ SetWriteDeadline(t time.Time) error }); ok {
+		_ = d.SetWriteDeadline(time.Now().Add(s.conn.listener.writeTimeout))
+	}
+
+	if err := s.writer.Write(*frame); err != nil {
+		s.conn.log.Debug("failed to write frame", "err", err)
+		s.conn.setCloseReason(err)
+		_ = s.conn.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// awaitWriters waits for the streams of the connection to write the frames still queued once the connection is
+// closed. As not every stream supports write deadlines, it gives up after the write timeout, after which closing
+// the streams unblocks their writers.
+func (c *conn) awaitWriters() {
+	if !c.writing {
+		return
+	}
+
+	timer := time.NewTimer(c.listener.writeTimeout)
+	defer timer.Stop()
+	for _, s := range c.streams {
+		select {
+		case <-s.done:
+		case <-timer.C:
+			c.log.Debug("timed out writing queued frames")
+			return
+		}
+	}
+}
+
+// openStreams opens an additional stream to the proxy for every priority in ListenConfig.Streams, after the proxy
+// requested additional streams using a StreamRequest. The proxy is always answered with a StreamResponse, so
+// that it knows which streams to expect, if any. No streams are opened if the transport does not support it.
+func (c *conn) openStreams() error {
+	opener, ok := c.conn.(tr.StreamOpener)
+	if !ok || len(c.listener.streams) == 0 {
+		return c.WritePacket(&dfpacket.StreamResponse{})
+	}
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	response := &dfpacket.StreamResponse{Token: token}
+	for _, priority := range c.listener.streams {
+		response.Priorities = append(response.Priorities, uint8(priority))
+	}
+	if err := c.WritePacket(response); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.listener.writeTimeout)
+	defer cancel()
+	for _, priority := range c.listener.streams {
+		header, err := c.encode(&dfpacket.StreamHeader{Token: token, Priority: uint8(priority)})
+		if err != nil {
+			return err
+		}
+
+		rwc, err := opener.OpenStream(ctx)
+		if err != nil {
+			putFrame(header)
+			return err
+		}
+
+		s := newStream(c, rwc)
+		s.route(priority)
+		c.streams = append(c.streams, s)
+		if err := s.writeFrame(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Filter decides which remote addresses are allowed to connect to a transport based on CIDR ranges. It is used
+// to make sure that only the proxy can reach the backend, even if its port is exposed.
+type Filter struct {
+	allow    []netip.Prefix
+	deny     []netip.Prefix
+	rejected atomic.Uint64
+}
+
+// NewFilter creates a Filter from the allowed and denied ranges passed. Ranges may be in CIDR notation
+// (10.0.0.0/8) or plain addresses, which are treated as a single-address range. An address matching any
+// denied range is rejected. If at least one allowed range is passed, addresses not matching any of them are
+// rejected as well.
+func NewFilter(allow []string, deny []string) (*Filter, error) {
+	allowPrefixes, err := parsePrefixes(allow)
+	if err != nil {
+		return nil, err
+	}
+
+	denyPrefixes, err := parsePrefixes(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{allow: allowPrefixes, deny: denyPrefixes}, nil
+}
+
+// Allowed reports whether the address passed is allowed to connect. A nil Filter allows every address.
+func (f *Filter) Allowed(addr net.Addr) bool {
+	if f == nil {
+		return true
+	}
+
+	ip, ok := addrIP(addr)
+	if !ok {
+		return len(f.allow) == 0
+	}
+
+	for _, prefix := range f.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	if len(f.allow) == 0 {
+		return true
+	}
+
+	for _, prefix := range f.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejected returns the number of connection attempts rejected by the Filter so far.
+func (f *Filter) Rejected() uint64 {
+	if f == nil {
+		return 0
+	}
+	return f.rejected.Load()
+}
+
+// accept reports whether the address passed is allowed to connect, counting and logging it if not.
+func (f *Filter) accept(addr net.Addr, log *slog.Logger) bool {
+	if f.Allowed(addr) {
+		return true
+	}
+
+	f.rejected.Add(1)
+	log.Warn("rejected connection from filtered address", "addr", addr)
+	return false
+}
+
+func parsePrefixes(ranges []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, r := range ranges {
+		if !strings.Contains(r, "/") {
+			addr, err := netip.ParseAddr(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", r, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", r, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func addrIP(addr net.Addr) (netip.Addr, bool) {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		ip, ok := netip.AddrFromSlice(addr.IP)
+		return ip.Unmap(), ok
+	case *net.TCPAddr:
+		ip, ok := netip.AddrFromSlice(addr.IP)
+		return ip.Unmap(), ok
+	case nil:
+		return netip.Addr{}, false
+	default:
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		return addrPort.Addr().Unmap(), true
+	}
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// DefaultQueueSize is the number of accepted streams a transport buffers until they are picked up by Accept.
+const DefaultQueueSize = 100
+
+// QueuePolicy specifies what a transport does with a newly accepted stream when its incoming queue is full.
+type QueuePolicy uint8
+
+const (
+	// QueuePolicyWait makes the transport wait until there is room in the queue or the transport is closed.
+	QueuePolicyWait QueuePolicy = iota
+	// QueuePolicyReject makes the transport close the stream immediately, so that the proxy may retry or
+	// route the player elsewhere.
+	QueuePolicyReject
+)
+
+// accepted is a stream accepted by a transport, along with the information about its connection.
+type accepted struct {
+	rwc  io.ReadWriteCloser
+	info StreamInfo
+}
+
+// queue is the queue of streams accepted by a transport, waiting to be returned from Accept.
+type queue struct {
+	incoming chan accepted
+	closed   chan struct{}
+	policy   QueuePolicy
+	dropped  atomic.Uint64
+}
+
+func newQueue(size int, policy QueuePolicy) *queue {
+	if size < 0 {
+		size = 0
+	}
+	return &queue{
+		incoming: make(chan accepted, size),
+		closed:   make(chan struct{}),
+		policy:   policy,
+	}
+}
+
+// push queues a stream so that it can be returned from pop. It returns false if the stream was not queued,
+// either because the queue was full and the policy is QueuePolicyReject or because the queue was closed. The
+// caller is responsible for closing the stream in that case.
+func (q *queue) push(rwc io.ReadWriteCloser, info StreamInfo) bool {
+	if q.isClosed() {
+		return false
+	}
+
+	if q.policy == QueuePolicyReject {
+		select {
+		case <-q.closed:
+			return false
+		case q.incoming <- accepted{rwc: rwc, info: info}:
+			return true
+		default:
+			q.dropped.Add(1)
+			return false
+		}
+	}
+
+	select {
+	case <-q.closed:
+		return false
+	case q.incoming <- accepted{rwc: rwc, info: info}:
+		return true
+	}
+}
+
+// pop blocks until a stream is queued or the queue is closed.
+func (q *queue) pop() (io.ReadWriteCloser, StreamInfo, error) {
+	select {
+	case <-q.closed:
+		return nil, StreamInfo{}, errors.New("closed listener")
+	case c := <-q.incoming:
+		return c.rwc, c.info, nil
+	}
+}
+
+// close closes the queue, closing all streams that were queued but never popped.
+func (q *queue) close() error {
+	select {
+	case <-q.closed:
+		return errors.New("already closed")
+	default:
+		close(q.closed)
+	}
+
+	for {
+		select {
+		case c := <-q.incoming:
+			_ = c.rwc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// isClosed reports whether the queue was closed.
+func (q *queue) isClosed() bool {
+	select {
+	case <-q.closed:
+		return true
+	default:
+		return false
+	}
+}
@@ -3,10 +3,12 @@ package transport
 import (
 	"context"
 	"crypto/tls"
-	"errors"
 	"io"
+	"log/slog"
+	"net"
 	"time"
 
+	"github.com/cooldogedev/spectrum-df/metrics"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/qlog"
 )
@@ -14,15 +16,18 @@ import (
 type QUIC struct {
 	cert     tls.Certificate
 	listener *quic.Listener
-	incoming chan io.ReadWriteCloser
-	closed   chan struct{}
+	filter   *Filter
+	queue    *queue
+	log      *slog.Logger
+	metrics  metrics.Collector
 }
 
 func NewQUIC(cert tls.Certificate) *QUIC {
 	return &QUIC{
-		cert:     cert,
-		incoming: make(chan io.ReadWriteCloser, 100),
-		closed:   make(chan struct{}),
+		cert:    cert,
+		queue:   newQueue(DefaultQueueSize, QueuePolicyWait),
+		log:     slog.Default().With("transport", "quic"),
+		metrics: metrics.NopCollector{},
 	}
 }
 
@@ -41,6 +46,7 @@ func (q *QUIC) Listen(addr string) (err error) {
 			InitialConnectionReceiveWindow: 1024 * 1024 * 10,
 			KeepAlivePeriod:                0,
 			InitialPacketSize:              1350,
+			EnableDatagrams:                true,
 			Tracer:                         qlog.DefaultConnectionTracer,
 		},
 	)
@@ -52,8 +58,15 @@ func (q *QUIC) Listen(addr string) (err error) {
 		for {
 			connection, err := listener.Accept(context.Background())
 			if err != nil {
+				q.log.Debug("stopped accepting connections", "err", err)
 				return
 			}
+
+			if !q.filter.accept(connection.RemoteAddr(), q.log) {
+				_ = connection.CloseWithError(0, "forbidden")
+				q.metrics.ConnectionRejected()
+				continue
+			}
 			go q.handle(connection)
 		}
 	}()
@@ -61,35 +74,98 @@ func (q *QUIC) Listen(addr string) (err error) {
 	return
 }
 
+// Addr returns the address the transport listens on.
+func (q *QUIC) Addr() net.Addr {
+	return q.listener.Addr()
+}
+
 // Accept ...
-func (q *QUIC) Accept() (io.ReadWriteCloser, error) {
-	select {
-	case <-q.closed:
-		return nil, errors.New("closed listener")
-	case c := <-q.incoming:
-		return c, nil
-	}
+func (q *QUIC) Accept() (io.ReadWriteCloser, StreamInfo, error) {
+	return q.queue.pop()
+}
+
+// SetFilter ...
+func (q *QUIC) SetFilter(filter *Filter) {
+	q.filter = filter
+}
+
+// SetLogger ...
+func (q *QUIC) SetLogger(log *slog.Logger) {
+	q.log = log
+}
+
+// SetMetrics sets the metrics.Collector that dropped streams and rejected connections are reported to.
+func (q *QUIC) SetMetrics(collector metrics.Collector) {
+	q.metrics = collector
+}
+
+// SetQueue sets the size of the queue holding accepted streams until they are returned from Accept, and the
+// policy applied when it is full. It must be called before Listen.
+func (q *QUIC) SetQueue(size int, policy QueuePolicy) {
+	q.queue = newQueue(size, policy)
+}
+
+// Dropped returns the number of streams closed because the incoming queue was full.
+func (q *QUIC) Dropped() uint64 {
+	return q.queue.dropped.Load()
 }
 
 // Close ...
 func (q *QUIC) Close() (err error) {
-	select {
-	case <-q.closed:
-		return errors.New("already closed")
-	default:
-		close(q.closed)
-		_ = q.listener.Close()
-		return
+	if err := q.queue.close(); err != nil {
+		return err
 	}
+	if err := q.listener.Close(); err != nil {
+		q.log.Debug("failed to close listener", "err", err)
+	}
+	return
 }
 
 func (q *QUIC) handle(connection *quic.Conn) {
 	defer connection.CloseWithError(0, "")
+	state := connection.ConnectionState().TLS
+	info := StreamInfo{Transport: "quic", RemoteAddr: connection.RemoteAddr(), TLS: &state}
 	for {
 		stream, err := connection.AcceptStream(context.Background())
 		if err != nil {
 			return
 		}
-		q.incoming <- stream
+
+		if !q.queue.push(&quicStream{Stream: stream, connection: connection}, info) {
+			stream.CancelRead(0)
+			_ = stream.Close()
+			if q.queue.isClosed() {
+				return
+			}
+			q.log.Warn("dropped stream: incoming queue is full")
+			q.metrics.StreamDropped()
+		}
+	}
+}
+
+// quicStream is a stream accepted by the QUIC transport. It implements StreamOpener and DatagramSender, opening
+// additional streams and sending datagrams on the connection of the proxy it was accepted from.
+type quicStream struct {
+	*quic.Stream
+	connection *quic.Conn
+}
+
+// OpenStream ...
+func (s *quicStream) OpenStream(ctx context.Context) (io.ReadWriteCloser, error) {
+	stream, err := s.connection.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return stream, nil
+}
+
+// SupportsDatagrams ...
+func (s *quicStream) SupportsDatagrams() bool {
+	state := s.connection.ConnectionState().SupportsDatagrams
+	return state.Local && state.Remote
+}
+
+// SendDatagram ...
+func (s *quicStream) SendDatagram(b []byte) error {
+	return s.connection.SendDatagram(b)
 }
@@ -2,28 +2,39 @@ package transport
 
 import (
 	"context"
-	"errors"
 	"io"
+	"log/slog"
+	"net"
 
 	"github.com/cooldogedev/spectral"
+	"github.com/cooldogedev/spectrum-df/metrics"
 )
 
 type Spectral struct {
 	listener *spectral.Listener
-	incoming chan io.ReadWriteCloser
-	closed   chan struct{}
+	addr     net.Addr
+	filter   *Filter
+	queue    *queue
+	log      *slog.Logger
+	metrics  metrics.Collector
 }
 
 func NewSpectral() *Spectral {
 	return &Spectral{
-		incoming: make(chan io.ReadWriteCloser, 100),
-		closed:   make(chan struct{}),
+		queue:   newQueue(DefaultQueueSize, QueuePolicyWait),
+		log:     slog.Default().With("transport", "spectral"),
+		metrics: metrics.NopCollector{},
 	}
 }
 
 // Listen ...
 func (s *Spectral) Listen(addr string) (err error) {
-	listener, err := spectral.Listen(addr)
+	udpAddr, err := resolveAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := spectral.Listen(udpAddr.String())
 	if err != nil {
 		return err
 	}
@@ -32,44 +43,110 @@ func (s *Spectral) Listen(addr string) (err error) {
 		for {
 			connection, err := listener.Accept(context.Background())
 			if err != nil {
+				s.log.Debug("stopped accepting connections", "err", err)
 				return
 			}
+
+			if !s.filter.accept(remoteAddr(connection), s.log) {
+				_ = connection.CloseWithError(0, "forbidden")
+				s.metrics.ConnectionRejected()
+				continue
+			}
 			go s.handle(connection)
 		}
 	}()
-	s.listener = listener
+	s.listener, s.addr = listener, udpAddr
 	return
 }
 
+// Addr returns the address the transport listens on.
+func (s *Spectral) Addr() net.Addr {
+	return s.addr
+}
+
 // Accept ...
-func (s *Spectral) Accept() (io.ReadWriteCloser, error) {
-	select {
-	case <-s.closed:
-		return nil, errors.New("closed listener")
-	case c := <-s.incoming:
-		return c, nil
-	}
+func (s *Spectral) Accept() (io.ReadWriteCloser, StreamInfo, error) {
+	return s.queue.pop()
+}
+
+// SetFilter ...
+func (s *Spectral) SetFilter(filter *Filter) {
+	s.filter = filter
+}
+
+// SetLogger ...
+func (s *Spectral) SetLogger(log *slog.Logger) {
+	s.log = log
+}
+
+// SetMetrics sets the metrics.Collector that dropped streams and rejected connections are reported to.
+func (s *Spectral) SetMetrics(collector metrics.Collector) {
+	s.metrics = collector
+}
+
+// SetQueue sets the size of the queue holding accepted streams until they are returned from Accept, and the
+// policy applied when it is full. It must be called before Listen.
+func (s *Spectral) SetQueue(size int, policy QueuePolicy) {
+	s.queue = newQueue(size, policy)
+}
+
+// Dropped returns the number of streams closed because the incoming queue was full.
+func (s *Spectral) Dropped() uint64 {
+	return s.queue.dropped.Load()
 }
 
 // Close ...
 func (s *Spectral) Close() (err error) {
-	select {
-	case <-s.closed:
-		return errors.New("already closed")
-	default:
-		close(s.closed)
-		_ = s.listener.Close()
-		return
+	if err := s.queue.close(); err != nil {
+		return err
+	}
+	if err := s.listener.Close(); err != nil {
+		s.log.Debug("failed to close listener", "err", err)
 	}
+	return
 }
 
 func (s *Spectral) handle(connection spectral.Connection) {
 	defer connection.CloseWithError(0, "failed to accept stream")
+	info := StreamInfo{Transport: "spectral", RemoteAddr: remoteAddr(connection)}
 	for {
 		stream, err := connection.AcceptStream(context.Background())
 		if err != nil {
 			return
 		}
-		s.incoming <- stream
+
+		if !s.queue.push(stream, info) {
+			_ = stream.Close()
+			if s.queue.isClosed() {
+				return
+			}
+			s.log.Warn("dropped stream: incoming queue is full")
+			s.metrics.StreamDropped()
+		}
+	}
+}
+
+// resolveAddr resolves the address passed, replacing a port of 0 with a free port, as the spectral listener does
+// not expose the address it is bound to.
+func resolveAddr(address string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil || addr.Port != 0 {
+		return addr, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr), nil
+}
+
+// remoteAddr returns the remote address of a spectral connection. The spectral.Connection interface does not
+// expose it, but the connections returned by its listener do.
+func remoteAddr(connection spectral.Connection) net.Addr {
+	if c, ok := connection.(interface{ RemoteAddr() net.Addr }); ok {
+		return c.RemoteAddr()
 	}
+	return nil
 }
@@ -1,9 +1,39 @@
 package transport
 
-import "io"
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+)
 
 type Transport interface {
 	Listen(string) error
-	Accept() (io.ReadWriteCloser, error)
+	Accept() (io.ReadWriteCloser, StreamInfo, error)
 	Close() error
 }
+
+// StreamInfo holds information about the connection of the proxy that a stream was accepted on.
+type StreamInfo struct {
+	// Transport is the name of the transport that accepted the stream, such as "quic" or "spectral".
+	Transport string
+	// RemoteAddr is the address of the proxy. It may be nil if the transport does not expose it.
+	RemoteAddr net.Addr
+	// TLS is the state of the TLS connection with the proxy, or nil if the transport does not use TLS.
+	TLS *tls.ConnectionState
+}
+
+// StreamOpener is implemented by the streams of transports that support opening additional streams to the proxy
+// on the connection a stream was accepted on.
+type StreamOpener interface {
+	OpenStream(ctx context.Context) (io.ReadWriteCloser, error)
+}
+
+// DatagramSender is implemented by the streams of transports that support sending unreliable datagrams to the
+// proxy on the connection a stream was accepted on.
+type DatagramSender interface {
+	// SupportsDatagrams reports if the proxy accepts datagrams on the connection.
+	SupportsDatagrams() bool
+	// SendDatagram sends a datagram to the proxy. It fails if the datagram is too large to be sent unfragmented.
+	SendDatagram(b []byte) error
+}